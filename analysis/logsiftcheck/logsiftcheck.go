@@ -0,0 +1,307 @@
+// Package logsiftcheck defines an analyzer that checks calls into logsift:
+// printf-style format strings of every *f method, *f calls without
+// formatting directives, filter topics missing from a registry file and
+// non-constant keys passed to With.
+package logsiftcheck
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+const logsiftPath = "github.com/jenish-rudani/logsift"
+
+const doc = `check calls into logsift
+
+Reports printf-style format strings that do not match their arguments in
+every *f function and method of logsift, including DebugFilterf and
+InfoFiltersf, *f calls without formatting directives, filter topics missing
+from the file given by -registry and non-constant keys passed to With.`
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "logsift",
+	Doc:      doc,
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+// registryPath is a file listing the known filter topics, see LoadRegistry
+var registryPath string
+
+func init() {
+	Analyzer.Flags.StringVar(&registryPath, "registry", "",
+		"file listing the known filter topics, one per line, as written by 'logsiftvet topics'")
+}
+
+// topicFuncs take filter topics as their first argument
+var topicFuncs = regexp.MustCompile(`^(Debug|Info|Warn|Error|Add|Remove)Filters?(Ln|f)?$`)
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	var known map[string]bool
+	if registryPath != "" {
+		var err error
+		if known, err = loadRegistryOnce(registryPath); err != nil {
+			return nil, err
+		}
+	}
+
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	inspect.Preorder([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node) {
+		call := n.(*ast.CallExpr)
+		fn := logsiftFunc(pass.TypesInfo, call)
+		if fn == nil {
+			return
+		}
+		if isPrintf(fn) {
+			checkPrintf(pass, call, fn)
+		}
+		if known != nil && topicFuncs.MatchString(fn.Name()) {
+			forEachTopic(pass.TypesInfo, call, func(topic string, arg ast.Expr) {
+				if !known[topic] {
+					pass.ReportRangef(arg, "filter topic %q is not in the registry %s", topic, registryPath)
+				}
+			})
+		}
+		// logsift's own With forwards its key
+		if fn.Name() == "With" && len(call.Args) == 2 && pass.Pkg.Path() != logsiftPath &&
+			pass.TypesInfo.Types[call.Args[0]].Value == nil {
+			pass.ReportRangef(call.Args[0], "With key %s is not a constant", types.ExprString(call.Args[0]))
+		}
+	})
+	return nil, nil
+}
+
+// logsiftFunc returns the logsift function or method called, nil if the call
+// is to something else
+func logsiftFunc(info *types.Info, call *ast.CallExpr) *types.Func {
+	fn, ok := typeutil.Callee(info, call).(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != logsiftPath {
+		return nil
+	}
+	return fn
+}
+
+// isPrintf reports whether fn takes a format string and variadic arguments
+// last, such as Infof and DebugFiltersf
+func isPrintf(fn *types.Func) bool {
+	sig := fn.Type().(*types.Signature)
+	params := sig.Params()
+	if !strings.HasSuffix(fn.Name(), "f") || !sig.Variadic() || params.Len() < 2 {
+		return false
+	}
+	format, ok := params.At(params.Len() - 2).Type().(*types.Basic)
+	return ok && format.Kind() == types.String
+}
+
+func checkPrintf(pass *analysis.Pass, call *ast.CallExpr, fn *types.Func) {
+	index := fn.Type().(*types.Signature).Params().Len() - 2
+	if len(call.Args) <= index || call.Ellipsis.IsValid() {
+		return
+	}
+	tv := pass.TypesInfo.Types[call.Args[index]]
+	if tv.Value == nil || tv.Value.Kind() != constant.String {
+		return
+	}
+	format := constant.StringVal(tv.Value)
+	args := call.Args[index+1:]
+	verbs, ok := parseFormat(format)
+	if !ok {
+		return
+	}
+	switch {
+	case len(verbs) == 0 && len(args) == 0:
+		pass.ReportRangef(call, "%s call has no formatting directives, use %s", fn.Name(), strings.TrimSuffix(fn.Name(), "f"))
+		return
+	case len(verbs) != len(args):
+		pass.ReportRangef(call, "%s format %q needs %d args but has %d", fn.Name(), format, len(verbs), len(args))
+		return
+	}
+	for i, verb := range verbs {
+		if t := pass.TypesInfo.Types[args[i]].Type; t != nil && !verbAccepts(verb, t) {
+			pass.ReportRangef(args[i], "%s format %%%c has arg %s of wrong type %s",
+				fn.Name(), verb, types.ExprString(args[i]), t)
+		}
+	}
+}
+
+// parseFormat returns the verb reading each argument, '*' for a width or
+// precision argument. It returns false for formats with explicit argument
+// indexes, which are not checked.
+func parseFormat(format string) ([]rune, bool) {
+	var verbs []rune
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		for i < len(format) && strings.IndexByte("+-# 0", format[i]) >= 0 {
+			i++
+		}
+		// width, then precision
+		for part := 0; part < 2; part++ {
+			if part == 1 {
+				if i >= len(format) || format[i] != '.' {
+					break
+				}
+				i++
+			}
+			if i < len(format) && format[i] == '*' {
+				verbs = append(verbs, '*')
+				i++
+			}
+			for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+				i++
+			}
+		}
+		if i >= len(format) {
+			break
+		}
+		if format[i] == '[' {
+			return nil, false
+		}
+		verb, size := utf8.DecodeRuneInString(format[i:])
+		i += size - 1
+		if verb != '%' {
+			verbs = append(verbs, verb)
+		}
+	}
+	return verbs, true
+}
+
+// verbAccepts reports whether an argument of type t suits verb. Interfaces,
+// fmt.Formatter and types other than basic ones are left to fmt.
+func verbAccepts(verb rune, t types.Type) bool {
+	basic, ok := t.Underlying().(*types.Basic)
+	if !ok || hasMethod(t, "Format") {
+		return true
+	}
+	info := basic.Info()
+	switch verb {
+	case '*':
+		return info&types.IsInteger != 0
+	case 'd':
+		return info&types.IsInteger != 0
+	case 's', 'q':
+		return info&types.IsString != 0 || hasMethod(t, "String") || hasMethod(t, "Error")
+	case 'e', 'E', 'f', 'F', 'g', 'G':
+		return info&(types.IsFloat|types.IsComplex) != 0
+	case 't':
+		return info&types.IsBoolean != 0
+	}
+	return true
+}
+
+func hasMethod(t types.Type, name string) bool {
+	obj, _, _ := types.LookupFieldOrMethod(t, true, nil, name)
+	_, ok := obj.(*types.Func)
+	return ok
+}
+
+// forEachTopic calls fn with the constant filter topics passed as the first
+// argument of call, a string or a []string literal
+func forEachTopic(info *types.Info, call *ast.CallExpr, fn func(topic string, arg ast.Expr)) {
+	if len(call.Args) == 0 {
+		return
+	}
+	arg := call.Args[0]
+	if lit, ok := ast.Unparen(arg).(*ast.CompositeLit); ok {
+		for _, elt := range lit.Elts {
+			if topic, ok := constantString(info, elt); ok {
+				fn(topic, elt)
+			}
+		}
+		return
+	}
+	if topic, ok := constantString(info, arg); ok {
+		fn(topic, arg)
+	}
+}
+
+func constantString(info *types.Info, e ast.Expr) (string, bool) {
+	tv := info.Types[e]
+	if tv.Value == nil || tv.Value.Kind() != constant.String {
+		return "", false
+	}
+	return constant.StringVal(tv.Value), true
+}
+
+// Topics returns the constant filter topics used or registered via
+// RegisterFilter in files, sorted and without duplicates.
+func Topics(files []*ast.File, info *types.Info) []string {
+	seen := make(map[string]bool)
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			if fn := logsiftFunc(info, call); fn != nil && (topicFuncs.MatchString(fn.Name()) || fn.Name() == "RegisterFilter") {
+				forEachTopic(info, call, func(topic string, _ ast.Expr) {
+					seen[topic] = true
+				})
+			}
+			return true
+		})
+	}
+	topics := make([]string, 0, len(seen))
+	for topic := range seen {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// LoadRegistry reads a registry file: one topic per line, optionally followed
+// by a description. Blank lines and lines starting with '#' are skipped.
+func LoadRegistry(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	known := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		known[strings.Fields(line)[0]] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading registry %s: %w", path, err)
+	}
+	return known, nil
+}
+
+var registries sync.Map
+
+type registry struct {
+	once  sync.Once
+	known map[string]bool
+	err   error
+}
+
+// loadRegistryOnce loads a registry file once for all packages analyzed
+func loadRegistryOnce(path string) (map[string]bool, error) {
+	v, _ := registries.LoadOrStore(path, &registry{})
+	r := v.(*registry)
+	r.once.Do(func() {
+		r.known, r.err = LoadRegistry(path)
+	})
+	return r.known, r.err
+}
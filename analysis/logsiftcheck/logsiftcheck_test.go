@@ -0,0 +1,83 @@
+package logsiftcheck
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestAnalyzer(t *testing.T) {
+	testdata := analysistest.TestData()
+	if err := Analyzer.Flags.Set("registry", filepath.Join(testdata, "topics.txt")); err != nil {
+		t.Fatal(err)
+	}
+	defer Analyzer.Flags.Set("registry", "")
+	analysistest.Run(t, testdata, Analyzer, "a")
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		verbs  string
+		ok     bool
+	}{
+		{"plain", "", true},
+		{"%d%%", "d", true},
+		{"%-8s|%+.3f|%#x", "sfx", true},
+		{"%*d %.*f", "*d*f", true},
+		{"%[1]d", "", false},
+		{"trailing %", "", true},
+	}
+	for _, tt := range tests {
+		verbs, ok := parseFormat(tt.format)
+		if string(verbs) != tt.verbs || ok != tt.ok {
+			t.Errorf("%q: expected %q %v, got %q %v", tt.format, tt.verbs, tt.ok, string(verbs), ok)
+		}
+	}
+}
+
+func TestTopics(t *testing.T) {
+	const src = `package b
+
+import "github.com/jenish-rudani/logsift"
+
+func f(topic string) {
+	logsift.DebugFilter("db", "x")
+	logsift.DebugFilters([]string{"auth", "db"}, "x")
+	logsift.RegisterFilter("billing", "invoices")
+	logsift.AddFieldFilter("tenant", "acme", 1)
+	logsift.DebugFilter(topic, "x")
+}
+`
+	fset := token.NewFileSet()
+	stubFile, err := parser.ParseFile(fset, filepath.Join(analysistest.TestData(), "src", logsiftPath, "logsift.go"), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub, err := new(types.Config).Check(logsiftPath, fset, []*ast.File{stubFile}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := parser.ParseFile(fset, "b.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue), Uses: make(map[*ast.Ident]types.Object)}
+	conf := types.Config{Importer: importerFunc(func(string) (*types.Package, error) { return stub, nil })}
+	if _, err := conf.Check("b", fset, []*ast.File{file}, info); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Topics([]*ast.File{file}, info), []string{"auth", "billing", "db"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
@@ -0,0 +1,58 @@
+package a
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jenish-rudani/logsift"
+)
+
+type id int
+
+func (id) String() string { return "id" }
+
+func printf(l logsift.Logger, x logsift.ExtendedLogger, n int, s string, f float64) {
+	logsift.Infof("%d items in %s", n, s)
+	logsift.Infof("%d%% done, %5.2f left, %*d wide", n, f, 3, n)
+	logsift.Infof("%d items", s)  // want `Infof format %d has arg s of wrong type string`
+	logsift.Infof("%s and %s", s) // want `Infof format "%s and %s" needs 2 args but has 1`
+	logsift.Infof("%v", s, n)     // want `Infof format "%v" needs 1 args but has 2`
+	logsift.Infof("%s %s", id(1), errors.New("e"))
+	logsift.Infof("%[2]d %[1]s", s, n)    // explicit indexes are not checked
+	logsift.Infof(fmt.Sprint(n))          // non-constant formats are not checked
+	logsift.Errorf("%t", n)               // want `Errorf format %t has arg n of wrong type int`
+	logsift.InfoFilterf("db", "%f ms", n) // want `InfoFilterf format %f has arg n of wrong type int`
+	logsift.InfoFiltersf([]string{"db"}, "%d rows", n)
+	logsift.InfoFiltersf([]string{"db"}, "rows %d") // want `InfoFiltersf format "rows %d" needs 1 args but has 0`
+	l.DebugFilterf("db", "query %s", n)             // want `DebugFilterf format %s has arg n of wrong type int`
+	l.DebugFiltersf([]string{"db"}, "%d", n)
+	x.V(2).Infof("%d", s)                   // want `Infof format %d has arg s of wrong type string`
+	logsift.V(1).InfoFilterf("db", "%s", n) // want `InfoFilterf format %s has arg n of wrong type int`
+	args := []interface{}{n}
+	logsift.Infof("%d %d", args...)
+}
+
+func noVerbs(l logsift.Logger) {
+	logsift.Infof("plain message")           // want `Infof call has no formatting directives, use Info`
+	logsift.InfoFilterf("db", "plain")       // want `InfoFilterf call has no formatting directives, use InfoFilter`
+	l.DebugFiltersf([]string{"db"}, "plain") // want `DebugFiltersf call has no formatting directives, use DebugFilters`
+	logsift.Infof("100%% plain")             // want `Infof call has no formatting directives, use Info`
+}
+
+func topics(l logsift.Logger, topic string) {
+	logsift.DebugFilter("db", "known")
+	logsift.DebugFilter("dbx", "unknown")                   // want `filter topic "dbx" is not in the registry`
+	logsift.DebugFilters([]string{"auth", "sessions"}, "x") // want `filter topic "sessions" is not in the registry`
+	l.InfoFilter("cache", "known")
+	logsift.AddFilter("payments") // want `filter topic "payments" is not in the registry`
+	logsift.DebugFilter(topic, "not constant")
+	logsift.AddFieldFilter("tenant", "acme", 1)
+	logsift.RegisterFilter("billing", "not checked")
+}
+
+func with(l logsift.Logger, key string) {
+	logsift.With("user", 1)
+	logsift.With(key, 1) // want `With key key is not a constant`
+	l.With("user"+"_id", 1)
+	l.With(fmt.Sprint(1), 1) // want `With key fmt.Sprint\(1\) is not a constant`
+}
@@ -0,0 +1,33 @@
+// Package logsift is a stub of the logsift API for the analyzer tests.
+package logsift
+
+type Logger interface {
+	Infof(string, ...interface{})
+	DebugFilterf(string, string, ...interface{})
+	DebugFiltersf([]string, string, ...interface{})
+	InfoFilter(string, ...interface{})
+	With(key string, value interface{}) Logger
+}
+
+type ExtendedLogger interface {
+	Logger
+	V(level int) Verbose
+}
+
+type Verbose struct{}
+
+func (Verbose) Infof(format string, args ...interface{})                      {}
+func (Verbose) InfoFilterf(filter string, format string, args ...interface{}) {}
+
+func Info(args ...interface{})                                          {}
+func Infof(format string, args ...interface{})                          {}
+func Errorf(format string, args ...interface{})                         {}
+func DebugFilter(filter string, args ...interface{})                    {}
+func DebugFilters(filters []string, args ...interface{})                {}
+func InfoFilterf(filter string, format string, args ...interface{})     {}
+func InfoFiltersf(filters []string, format string, args ...interface{}) {}
+func AddFilter(filter string)                                           {}
+func AddFieldFilter(key, value string, ttl int)                         {}
+func RegisterFilter(name, description string)                           {}
+func With(key string, value interface{}) Logger                         { return nil }
+func V(level int) Verbose                                               { return Verbose{} }
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jenish-rudani/logsift"
+	"github.com/sirupsen/logrus"
+)
+
+const ctlUsage = `usage: logsift ctl [flags] command [args]
+
+Changes the logging of running processes through logsift.Handler.
+
+commands:
+  status                show the state and the enabled filters
+  level LEVEL           set the level, -for reverts it after a while
+  filters ls            list the filter topics
+  filters add TOPIC...  enable filters, -for disables them after a while
+  filters rm TOPIC...   disable filters
+  filters reset         disable all filters
+  set NAME=VALUE...     set Handler parameters, such as format=json
+
+`
+
+// ctl is a client of the Handler of one or more processes
+type ctl struct {
+	// Handler urls, such as http://localhost:8080/log
+	urls   []*url.URL
+	token  string
+	client *http.Client
+}
+
+func runCtl(args []string, stdout, stderr io.Writer, done <-chan struct{}) error {
+	fs := flag.NewFlagSet("logsift ctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		addr    = fs.String("addr", "localhost:8080", "comma-separated `host:port` or urls of the processes")
+		hosts   = fs.String("hosts", "", "file listing the processes, one address per line")
+		path    = fs.String("path", "/log", "path the Handler is mounted on, for addresses without one")
+		token   = fs.String("token", os.Getenv("LOGSIFT_TOKEN"), "bearer token sent to the processes, LOGSIFT_TOKEN by default")
+		timeout = fs.Duration("timeout", 10*time.Second, "timeout of each request")
+		revert  = fs.Duration("for", 0, "revert the change after this `duration`, waiting for it")
+		restore = fs.String("restore", "info", "level to revert to when a process does not report its level")
+	)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), ctlUsage)
+		fs.PrintDefaults()
+	}
+	// flags may follow the command and its arguments
+	var cmd []string
+	for rest := args; ; {
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		if rest = fs.Args(); len(rest) == 0 {
+			break
+		}
+		cmd, rest = append(cmd, rest[0]), rest[1:]
+	}
+	if len(cmd) == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	addrs := strings.Split(*addr, ",")
+	if *hosts != "" {
+		var err error
+		if addrs, err = readHosts(*hosts); err != nil {
+			return err
+		}
+	}
+	c := &ctl{token: *token, client: &http.Client{Timeout: *timeout}}
+	for _, a := range addrs {
+		u, err := handlerURL(a, *path)
+		if err != nil {
+			return err
+		}
+		c.urls = append(c.urls, u)
+	}
+
+	ctx := context.Background()
+	name, args := cmd[0], cmd[1:]
+	if name == "filters" && len(args) > 0 {
+		name, args = "filters "+args[0], args[1:]
+	}
+	switch name {
+	case "status":
+		return c.each(stdout, func(u *url.URL, w io.Writer) error {
+			return c.status(ctx, u, w)
+		})
+	case "filters ls":
+		return c.each(stdout, func(u *url.URL, w io.Writer) error {
+			return c.listTopics(ctx, u, w)
+		})
+	case "level":
+		if len(args) != 1 {
+			return errors.New("usage: logsift ctl level LEVEL")
+		}
+		if _, err := logrus.ParseLevel(args[0]); err != nil {
+			return err
+		}
+		if _, err := logrus.ParseLevel(*restore); err != nil {
+			return err
+		}
+		// levels to revert to by url
+		var mu sync.Mutex
+		previous := make(map[*url.URL]string)
+		err := c.each(stdout, func(u *url.URL, w io.Writer) error {
+			level := *restore
+			if state, err := c.state(ctx, u); err == nil && state["level"] != nil {
+				level = fmt.Sprint(state["level"])
+			}
+			mu.Lock()
+			previous[u] = level
+			mu.Unlock()
+			return c.set(ctx, u, w, url.Values{"level": {args[0]}})
+		})
+		if err != nil || *revert == 0 {
+			return err
+		}
+		return c.revert(stdout, *revert, done, func(u *url.URL, w io.Writer) error {
+			return c.set(ctx, u, w, url.Values{"level": {previous[u]}})
+		})
+	case "filters add", "filters rm":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: logsift ctl %s TOPIC...", name)
+		}
+		topics := strings.Join(args, ",")
+		param, undo := "addFilter", "removeFilter"
+		if name == "filters rm" {
+			param, undo = undo, param
+		}
+		err := c.each(stdout, func(u *url.URL, w io.Writer) error {
+			return c.set(ctx, u, w, url.Values{param: {topics}})
+		})
+		if err != nil || *revert == 0 {
+			return err
+		}
+		return c.revert(stdout, *revert, done, func(u *url.URL, w io.Writer) error {
+			return c.set(ctx, u, w, url.Values{undo: {topics}})
+		})
+	case "filters reset":
+		return c.each(stdout, func(u *url.URL, w io.Writer) error {
+			return c.set(ctx, u, w, url.Values{"resetFilter": {"true"}})
+		})
+	case "set":
+		values := url.Values{}
+		for _, arg := range args {
+			name, value, ok := strings.Cut(arg, "=")
+			if !ok || name == "" {
+				return fmt.Errorf("expected name=value, got %q", arg)
+			}
+			values.Set(name, value)
+		}
+		if len(values) == 0 {
+			return errors.New("usage: logsift ctl set NAME=VALUE...")
+		}
+		return c.each(stdout, func(u *url.URL, w io.Writer) error {
+			return c.set(ctx, u, w, values)
+		})
+	}
+	return fmt.Errorf("unknown command %q, see logsift ctl -h", strings.Join(cmd, " "))
+}
+
+// readHosts reads the addresses of a hosts file, skipping blank lines and
+// '#' comments
+func readHosts(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var addrs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			addrs = append(addrs, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses in %s", file)
+	}
+	return addrs, nil
+}
+
+// handlerURL turns a host:port or url into the Handler url, adding path if
+// addr has none
+func handlerURL(addr, path string) (*url.URL, error) {
+	addr = strings.TrimSpace(addr)
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid address %q", addr)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = path
+	}
+	return u, nil
+}
+
+// each runs fn for every url concurrently, then writes their output in
+// order, prefixed by the host when there are several
+func (c *ctl) each(stdout io.Writer, fn func(u *url.URL, w io.Writer) error) error {
+	outs := make([]bytes.Buffer, len(c.urls))
+	errs := make([]error, len(c.urls))
+	var wg sync.WaitGroup
+	for i, u := range c.urls {
+		wg.Go(func() {
+			errs[i] = fn(u, &outs[i])
+		})
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, u := range c.urls {
+		if errs[i] != nil {
+			failed++
+			fmt.Fprintf(&outs[i], "error: %v\n", errs[i])
+		}
+		prefix := ""
+		if len(c.urls) > 1 {
+			prefix = u.Host + ": "
+		}
+		for _, line := range strings.SplitAfter(outs[i].String(), "\n") {
+			if line == "" {
+				continue
+			}
+			if _, err := io.WriteString(stdout, prefix+line); err != nil {
+				return err
+			}
+		}
+	}
+	switch {
+	case failed == 0:
+		return nil
+	case len(c.urls) == 1:
+		return errs[0]
+	}
+	return fmt.Errorf("%d of %d processes failed", failed, len(c.urls))
+}
+
+// revert waits for d, or until done is closed, then runs fn for every url
+func (c *ctl) revert(stdout io.Writer, d time.Duration, done <-chan struct{}, fn func(u *url.URL, w io.Writer) error) error {
+	fmt.Fprintf(stdout, "reverting in %s, interrupt to revert now\n", d)
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-done:
+	}
+	return c.each(stdout, fn)
+}
+
+// get requests the Handler url, or one under it such as "topics", asking for
+// json
+func (c *ctl) get(ctx context.Context, u *url.URL, sub string, values url.Values) (body []byte, isJSON bool, err error) {
+	target := *u
+	if sub != "" {
+		target.Path = strings.TrimSuffix(target.Path, "/") + "/" + sub
+	}
+	target.RawQuery = values.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	body, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg := strings.TrimSpace(string(body))
+		if msg == "" {
+			msg = http.StatusText(resp.StatusCode)
+		}
+		return nil, false, fmt.Errorf("%s: %d %s", target.Path, resp.StatusCode, msg)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return body, mediaType == "application/json", nil
+}
+
+// stateKeys maps the Handler parameters to the state they change
+var stateKeys = map[string]string{
+	"filter":       "filters",
+	"addFilter":    "filters",
+	"removeFilter": "filters",
+	"resetFilter":  "filters",
+	"fieldFilter":  "fieldFilters",
+	"rateLimit":    "rateLimits",
+}
+
+// set changes settings and shows the resulting state of those settings, if
+// the Handler returns it
+func (c *ctl) set(ctx context.Context, u *url.URL, w io.Writer, values url.Values) error {
+	body, isJSON, err := c.get(ctx, u, "", values)
+	if err != nil {
+		return err
+	}
+	var state map[string]json.RawMessage
+	if !isJSON || json.Unmarshal(body, &state) != nil {
+		fmt.Fprintf(w, "set %s\n", strings.ReplaceAll(values.Encode(), "&", " "))
+		return nil
+	}
+	var keys []string
+	for param := range values {
+		key := param
+		if k, ok := stateKeys[param]; ok {
+			key = k
+		}
+		if _, ok := state[key]; ok && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s=%s\n", key, state[key])
+	}
+	return nil
+}
+
+// state returns the state the Handler reports, an error if it reports none
+func (c *ctl) state(ctx context.Context, u *url.URL) (map[string]interface{}, error) {
+	body, isJSON, err := c.get(ctx, u, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if !isJSON {
+		return nil, errors.New("no state reported")
+	}
+	var state map[string]interface{}
+	return state, json.Unmarshal(body, &state)
+}
+
+// status shows the state the Handler reports, if any, and the enabled
+// filters among the known topics
+func (c *ctl) status(ctx context.Context, u *url.URL, w io.Writer) error {
+	body, isJSON, err := c.get(ctx, u, "", nil)
+	if err != nil {
+		return err
+	}
+	if isJSON {
+		if err := writeJSON(w, body); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintln(w, "reachable, no state reported")
+	}
+	topics, err := c.topics(ctx, u)
+	if err != nil {
+		return err
+	}
+	var enabled []string
+	for _, t := range topics {
+		if t.Enabled {
+			enabled = append(enabled, t.Name)
+		}
+	}
+	if len(enabled) == 0 {
+		fmt.Fprintln(w, "filters: none of the known topics enabled")
+		return nil
+	}
+	fmt.Fprintf(w, "filters: %s\n", strings.Join(enabled, ", "))
+	return nil
+}
+
+func (c *ctl) topics(ctx context.Context, u *url.URL) ([]logsift.TopicInfo, error) {
+	body, _, err := c.get(ctx, u, "topics", nil)
+	if err != nil {
+		return nil, err
+	}
+	var topics []logsift.TopicInfo
+	if err := json.Unmarshal(body, &topics); err != nil {
+		return nil, fmt.Errorf("topics: %w", err)
+	}
+	return topics, nil
+}
+
+func (c *ctl) listTopics(ctx context.Context, u *url.URL, w io.Writer) error {
+	topics, err := c.topics(ctx, u)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TOPIC\tENABLED\tHITS\tSUPPRESSED\tDESCRIPTION")
+	for _, t := range topics {
+		fmt.Fprintf(tw, "%s\t%t\t%d\t%d\t%s\n", t.Name, t.Enabled, t.Hits, t.Suppressed, t.Description)
+	}
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, body []byte) error {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, body, "", "  "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
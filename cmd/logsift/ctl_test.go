@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jenish-rudani/logsift"
+)
+
+// newHandlerServer serves logsift.Handler on /log/, requiring token
+func newHandlerServer(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("/log/", logsift.Handler())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func enabled(topic string) bool {
+	for _, t := range logsift.Topics() {
+		if t.Name == topic {
+			return t.Enabled
+		}
+	}
+	return false
+}
+
+func runCtlOutput(t *testing.T, done <-chan struct{}, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	err := run(append([]string{"ctl"}, args...), nil, &out, io.Discard, done)
+	return out.String(), err
+}
+
+func TestCtl(t *testing.T) {
+	logsift.SetOutput(io.Discard)
+	logsift.SetLevel("info")
+	logsift.UpdateFilter(map[string]bool{"cache": true})
+	logsift.RegisterFilter("db", "database queries")
+	logsift.RegisterFilter("cache", "")
+	logsift.RegisterFilter("auth", "")
+	t.Cleanup(func() {
+		logsift.SetLevel("info")
+		logsift.UpdateFilter(map[string]bool{})
+	})
+	a, b := newHandlerServer(t, "secret"), newHandlerServer(t, "secret")
+	addr := a.URL + "/log/," + strings.TrimPrefix(b.URL, "http://")
+
+	out, err := runCtlOutput(t, nil, "-addr", addr, "-token", "secret", "level", "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := logsift.GetLevel(); got != "debug" {
+		t.Errorf("expected level debug, got %q", got)
+	}
+	hostA, hostB := strings.TrimPrefix(a.URL, "http://"), strings.TrimPrefix(b.URL, "http://")
+	want := hostA + ": level=\"debug\"\n" + hostB + ": level=\"debug\"\n"
+	if out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+
+	out, err = runCtlOutput(t, nil, "-addr", a.URL, "-token", "secret", "filters", "add", "db", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `filters={"auth":true,"cache":true,"db":true}` + "\n"; out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+	if !enabled("db") || !enabled("auth") || !enabled("cache") {
+		t.Error("expected db and auth to be added to cache")
+	}
+	out, err = runCtlOutput(t, nil, "-addr", a.URL, "-token", "secret", "filters", "ls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "TOPIC") || !strings.Contains(out, "database queries") {
+		t.Errorf("expected a table of topics, got %q", out)
+	}
+	out, err = runCtlOutput(t, nil, "-addr", a.URL, "-token", "secret", "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "filters: auth, cache, db") {
+		t.Errorf("expected the enabled filters, got %q", out)
+	}
+
+	if _, err := runCtlOutput(t, nil, "-addr", a.URL, "-token", "secret", "filters", "rm", "db"); err != nil {
+		t.Fatal(err)
+	}
+	if enabled("db") || !enabled("auth") {
+		t.Error("expected only db to be removed")
+	}
+
+	// reverted at once as done is closed
+	done := make(chan struct{})
+	close(done)
+	out, err = runCtlOutput(t, done, "-addr", a.URL, "-token", "secret", "filters", "add", "db", "-for", "1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enabled("db") || !strings.Contains(out, "reverting in 1h0m0s") {
+		t.Errorf("expected db to be reverted, got %q", out)
+	}
+	logsift.SetLevel("warn")
+	if _, err := runCtlOutput(t, done, "-addr", a.URL, "-token", "secret", "level", "trace", "--for", "10m"); err != nil {
+		t.Fatal(err)
+	}
+	if got := logsift.GetLevel(); got != "warning" {
+		t.Errorf("expected the level to be restored to warning, got %q", got)
+	}
+
+	if _, err := runCtlOutput(t, nil, "-addr", a.URL, "-token", "secret", "set", "format=json", "sourceFormat=long"); err != nil {
+		t.Fatal(err)
+	}
+	if logsift.GetFormat() != "json" || logsift.GetSourceFormat() != "long" {
+		t.Errorf("expected format json and source format long, got %q, %q", logsift.GetFormat(), logsift.GetSourceFormat())
+	}
+	logsift.SetFormat("text")
+	logsift.SetSourceFormat("short")
+
+	_, err = runCtlOutput(t, nil, "-addr", a.URL, "-token", "secret", "set", "dedup=soon")
+	if err == nil || !strings.Contains(err.Error(), "400 invalid value for dedup") {
+		t.Errorf("expected the handler's error, got %v", err)
+	}
+	out, err = runCtlOutput(t, nil, "-addr", addr, "-token", "wrong", "status")
+	if err == nil || err.Error() != "2 of 2 processes failed" || !strings.Contains(out, hostB+": error: /log: 401 unauthorized") {
+		t.Errorf("expected both processes to fail, got %v, %q", err, out)
+	}
+}
+
+// a Handler reporting no state
+func TestCtl_NoState(t *testing.T) {
+	var mu sync.Mutex
+	var levels []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/log/topics" {
+			io.WriteString(w, `[]`)
+			return
+		}
+		levels = append(levels, r.FormValue("level"))
+	}))
+	defer srv.Close()
+
+	done := make(chan struct{})
+	close(done)
+	out, err := runCtlOutput(t, done, "-addr", srv.URL, "level", "debug", "-for", "1m", "-restore", "warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, "set level=debug\n") || strings.Join(levels, ",") != ",debug,warn" {
+		t.Errorf("expected debug then -restore, got %q and %q", out, levels)
+	}
+	out, err = runCtlOutput(t, nil, "-addr", srv.URL, "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "reachable, no state reported\nfilters: none of the known topics enabled\n" {
+		t.Errorf("got %q", out)
+	}
+}
+
+// a Handler reporting its state as json
+func TestCtl_State(t *testing.T) {
+	var mu sync.Mutex
+	level := "warning"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/log/topics" {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `[{"name":"db","enabled":true}]`)
+			return
+		}
+		if v := r.FormValue("level"); v != "" {
+			level = v
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"level":"`+level+`"}`)
+	}))
+	defer srv.Close()
+
+	out, err := runCtlOutput(t, nil, "-addr", srv.URL, "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"level\": \"warning\"\n}\nfilters: db\n"; out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+
+	done := make(chan struct{})
+	close(done)
+	out, err = runCtlOutput(t, done, "-addr", srv.URL, "level", "debug", "-for", "1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, `level="debug"`) || level != "warning" {
+		t.Errorf("expected debug then the reported level restored, got %q and %q", out, level)
+	}
+}
+
+func TestCtl_Errors(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"status", "-addr", "http://"},
+		{"level"},
+		{"level", "loud"},
+		{"filters", "add"},
+		{"set", "level"},
+		{"restart"},
+		{"-hosts", filepath.Join(t.TempDir(), "missing"), "status"},
+	} {
+		if _, err := runCtlOutput(t, nil, args...); err == nil {
+			t.Errorf("ctl %q succeeded, want an error", args)
+		}
+	}
+}
+
+func TestReadHosts(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hosts")
+	os.WriteFile(file, []byte("# api\napi-1:8080\n\n  api-2:8080  # canary\nhttps://api-3/admin/log\n"), 0o644)
+	addrs, err := readHosts(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(addrs, " ") != "api-1:8080 api-2:8080 https://api-3/admin/log" {
+		t.Errorf("got %q", addrs)
+	}
+
+	u, _ := handlerURL(addrs[0], "/log")
+	if u.String() != "http://api-1:8080/log" {
+		t.Errorf("got %s", u)
+	}
+	u, _ = handlerURL(addrs[2], "/log")
+	if u.String() != "https://api-3/admin/log" {
+		t.Errorf("got %s", u)
+	}
+}
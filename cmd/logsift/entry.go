@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// keys of the time, level and message under the json format and the
+// structured presets
+var (
+	timeKeys  = []string{"time", "@timestamp", "date"}
+	levelKeys = []string{"level", "log.level", "severity", "status"}
+	msgKeys   = []string{"msg", "message"}
+)
+
+// entry is a parsed json line
+type entry struct {
+	raw      []byte
+	time     time.Time
+	timeText string
+	level    string
+	rank     logrus.Level
+	msg      string
+	source   string
+	filters  []string
+	// remaining fields
+	fields map[string]interface{}
+}
+
+// parseEntry parses a json line, returning false if it is not a json object
+func parseEntry(line []byte) (*entry, bool) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(line, &fields); err != nil || fields == nil {
+		return nil, false
+	}
+	e := &entry{raw: line, fields: fields, rank: logrus.InfoLevel}
+	e.timeText = take(fields, timeKeys)
+	if t, err := time.Parse(time.RFC3339Nano, e.timeText); err == nil {
+		e.time = t
+	}
+	e.level = strings.ToLower(take(fields, levelKeys))
+	switch e.level {
+	case "warn":
+		e.level = "warning"
+	case "critical", "alert", "emergency":
+		e.level = "fatal"
+	case "default", "notice":
+		e.level = "info"
+	}
+	if rank, err := logrus.ParseLevel(e.level); err == nil {
+		e.rank = rank
+	}
+	e.msg = take(fields, msgKeys)
+	e.source = source(fields["source"])
+	delete(fields, "source")
+	if filter, ok := fields["filter"].(string); ok && filter != "" {
+		e.filters = strings.Split(filter, ",")
+		delete(fields, "filter")
+	}
+	return e, true
+}
+
+// take removes and returns the first of keys present in fields
+func take(fields map[string]interface{}, keys []string) string {
+	for _, key := range keys {
+		if v, ok := fields[key]; ok {
+			delete(fields, key)
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+// source renders the "source" field, a " file:line " string or an object
+// with file and line
+func source(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case map[string]interface{}:
+		if file, ok := v["file"].(string); ok {
+			return fmt.Sprintf("%s:%v", file, v["line"])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"time"
+)
+
+// readLines calls fn with each line of r, without the line ending
+func readLines(r io.Reader, fn func(line []byte) error) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			if err := fn(bytes.TrimRight(line, "\r\n")); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// follow calls fn with each line of path like tail -f: the lines there are,
+// then those appended, polling every 'poll' until done is closed. The file is
+// reopened if it is truncated or replaced, as on rotation.
+func follow(path string, poll time.Duration, done <-chan struct{}, fn func(line []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+
+	br := bufio.NewReader(f)
+	var partial []byte
+	var offset int64
+	for {
+		line, err := br.ReadBytes('\n')
+		offset += int64(len(line))
+		if err == nil {
+			line = append(partial, line...)
+			partial = nil
+			if err := fn(bytes.TrimRight(line, "\r\n")); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+		// keep an incomplete last line until the writer finishes it
+		partial = append(partial, line...)
+
+		select {
+		case <-done:
+			return nil
+		case <-time.After(poll):
+		}
+
+		current, err := os.Stat(path)
+		if err != nil {
+			// rotated away, wait for the new file
+			continue
+		}
+		opened, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if os.SameFile(current, opened) && current.Size() >= offset {
+			continue
+		}
+		next, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		f.Close()
+		f, offset, partial = next, 0, nil
+		br.Reset(f)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFollow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("one\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var lines []string
+	done := make(chan struct{})
+	finished := make(chan error)
+	go func() {
+		finished <- follow(path, 5*time.Millisecond, done, func(line []byte) error {
+			mu.Lock()
+			lines = append(lines, string(line))
+			mu.Unlock()
+			return nil
+		})
+	}()
+	waitFor := func(n int) {
+		t.Helper()
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			mu.Lock()
+			got := len(lines)
+			mu.Unlock()
+			if got >= n {
+				return
+			}
+		}
+		t.Fatalf("timed out waiting for %d lines, got %q", n, lines)
+	}
+	waitFor(1)
+
+	// appended, with a line written in two parts
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString("two\nthr")
+	time.Sleep(20 * time.Millisecond)
+	f.WriteString("ee\n")
+	f.Close()
+	waitFor(3)
+
+	// rotated
+	os.Rename(path, path+".1")
+	os.WriteFile(path, []byte("four\n"), 0o644)
+	waitFor(4)
+
+	// truncated
+	os.WriteFile(path, []byte("5\n"), 0o644)
+	waitFor(5)
+
+	close(done)
+	if err := <-finished; err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"one", "two", "three", "four", "5"}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Fatalf("got %q, want %q", lines, want)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+// Command logsift reads the json lines logsift writes with
+// SetFormat("json"), from files or stdin, and prints them in color with the
+// source aligned. Entries can be filtered by level, topic, field and time,
+// files followed like tail -f and converted to logfmt or text:
+//
+//	logsift app.log
+//	logsift -level warn -topic 'db.*' -field tenant=acme -since 15m app.log
+//	logsift -f -o logfmt app.log
+//	kubectl logs -f pod | logsift
+//
+// logsift ctl changes the logging of running processes through their
+// logsift.Handler:
+//
+//	logsift ctl -addr host:8080 level debug -for 10m
+//	logsift ctl -hosts hosts.txt filters add db auth
+//	logsift ctl filters ls
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	done := make(chan struct{})
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		close(done)
+	}()
+
+	err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr, done)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp), errors.Is(err, syscall.EPIPE):
+	default:
+		fmt.Fprintln(os.Stderr, "logsift:", err)
+		os.Exit(2)
+	}
+}
+
+const usage = `usage: logsift [flags] [file ...]
+       logsift ctl [flags] command [args]
+
+Prints the json lines of the files, or stdin, in color. Lines that are not
+json are printed as they are unless entries are filtered. See logsift ctl -h
+to change the logging of running processes.
+
+`
+
+// pollInterval is how often followed files are checked for new lines
+var pollInterval = 250 * time.Millisecond
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer, done <-chan struct{}) error {
+	if len(args) > 0 && args[0] == "ctl" {
+		return runCtl(args[1:], stdout, stderr, done)
+	}
+	fs := flag.NewFlagSet("logsift", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		m      matcher
+		level  = fs.String("level", "", "show entries at this level or more severe")
+		topics = fs.String("topic", "", "show filtered entries with one of these comma-separated topics, globs allowed")
+		since  = fs.String("since", "", "show entries from this time, RFC 3339 or a duration such as 15m before now")
+		until  = fs.String("until", "", "show entries up to this time, RFC 3339 or a duration before now")
+		follow = fs.Bool("f", false, "follow the files as they grow")
+		format = fs.String("o", "", "output format: "+strings.Join(formats, ", ")+" (default pretty on a terminal, text otherwise)")
+	)
+	fs.Var(&m.fields, "field", "show entries whose field matches `key=value`, repeatable")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *level != "" {
+		l, err := logrus.ParseLevel(*level)
+		if err != nil {
+			return err
+		}
+		m.level, m.hasLevel = l, true
+	}
+	if *topics != "" {
+		m.topics = strings.Split(*topics, ",")
+		for _, topic := range m.topics {
+			if _, err := path.Match(topic, ""); err != nil {
+				return fmt.Errorf("invalid topic %q: %w", topic, err)
+			}
+		}
+	}
+	now := time.Now()
+	var err error
+	if m.since, err = parseTime(*since, now); err != nil {
+		return err
+	}
+	if m.until, err = parseTime(*until, now); err != nil {
+		return err
+	}
+	p := &printer{format: *format}
+	if p.format == "" {
+		p.format = "text"
+		if isTerminal(stdout) {
+			p.format = "pretty"
+		}
+	}
+	if !slices.Contains(formats, p.format) {
+		return fmt.Errorf("unknown output format %q", p.format)
+	}
+
+	var mu sync.Mutex
+	print := func(line []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		e, ok := parseEntry(line)
+		switch {
+		case ok && m.match(e):
+			return p.print(stdout, e)
+		case !ok && m.empty() && len(line) > 0:
+			_, err := fmt.Fprintf(stdout, "%s\n", line)
+			return err
+		}
+		return nil
+	}
+
+	files := fs.Args()
+	if len(files) == 0 || (len(files) == 1 && files[0] == "-") {
+		return readLines(stdin, print)
+	}
+	if !*follow {
+		for _, file := range files {
+			if err := readFile(file, print); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	errs := make(chan error, len(files))
+	for _, file := range files {
+		go func() {
+			errs <- followFile(file, done, print)
+		}()
+	}
+	for range files {
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFile(file string, fn func([]byte) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return readLines(f, fn)
+}
+
+func followFile(file string, done <-chan struct{}, fn func([]byte) error) error {
+	return follow(file, pollInterval, done, fn)
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// parseTime parses an RFC 3339 time, a date, or a duration before now
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339, a date or a duration", s)
+}
+
+// matcher selects the entries to print
+type matcher struct {
+	level    logrus.Level
+	hasLevel bool
+	topics   []string
+	fields   fieldFlags
+	since    time.Time
+	until    time.Time
+}
+
+func (m *matcher) empty() bool {
+	return !m.hasLevel && len(m.topics) == 0 && len(m.fields) == 0 && m.since.IsZero() && m.until.IsZero()
+}
+
+func (m *matcher) match(e *entry) bool {
+	if m.hasLevel && e.rank > m.level {
+		return false
+	}
+	if len(m.topics) > 0 && !m.matchTopics(e.filters) {
+		return false
+	}
+	for _, f := range m.fields {
+		v, ok := e.fields[f.key]
+		if !ok {
+			return false
+		}
+		if s, isString := v.(string); (isString && s != f.value) || (!isString && value(v) != f.value) {
+			return false
+		}
+	}
+	if !m.since.IsZero() && (e.time.IsZero() || e.time.Before(m.since)) {
+		return false
+	}
+	if !m.until.IsZero() && (e.time.IsZero() || e.time.After(m.until)) {
+		return false
+	}
+	return true
+}
+
+func (m *matcher) matchTopics(filters []string) bool {
+	for _, filter := range filters {
+		for _, topic := range m.topics {
+			if ok, _ := path.Match(topic, filter); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type fieldFlag struct{ key, value string }
+
+// fieldFlags collects repeated -field key=value flags
+type fieldFlags []fieldFlag
+
+func (f *fieldFlags) String() string {
+	pairs := make([]string, len(*f))
+	for i, field := range *f {
+		pairs[i] = field.key + "=" + field.value
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f *fieldFlags) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	*f = append(*f, fieldFlag{key, value})
+	return nil
+}
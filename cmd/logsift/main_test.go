@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sample = `{"level":"info","msg":"started","source":" main.go:10 ","time":"2026-10-18T14:47:16Z"}
+{"level":"debug","msg":"query took","filter":"db.query","tenant":"acme","duration_ms":120,"source":" db/conn.go:142 ","time":"2026-10-18T14:47:17Z"}
+panic: oops
+{"level":"warning","msg":"slow request","filter":"http","source":" http.go:7 ","time":"2026-10-18T14:47:18Z"}
+`
+
+func runLines(t *testing.T, args ...string) []string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := run(args, strings.NewReader(sample), &out, io.Discard, nil); err != nil {
+		t.Fatalf("run(%q): %v", args, err)
+	}
+	return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+}
+
+func TestRun_Filters(t *testing.T) {
+	tests := []struct {
+		args []string
+		msgs []string
+	}{
+		{nil, []string{"started", "query took", "panic: oops", "slow request"}},
+		{[]string{"-level", "info"}, []string{"started", "slow request"}},
+		{[]string{"-level", "warn"}, []string{"slow request"}},
+		{[]string{"-topic", "db.*"}, []string{"query took"}},
+		{[]string{"-topic", "auth,http"}, []string{"slow request"}},
+		{[]string{"-field", "tenant=acme"}, []string{"query took"}},
+		{[]string{"-field", "duration_ms=120", "-field", "tenant=acme"}, []string{"query took"}},
+		{[]string{"-field", "tenant=other"}, nil},
+		{[]string{"-since", "2026-10-18T14:47:17Z"}, []string{"query took", "slow request"}},
+		{[]string{"-until", "2026-10-18T14:47:17Z"}, []string{"started", "query took"}},
+	}
+	for _, tt := range tests {
+		lines := runLines(t, append([]string{"-o", "logfmt"}, tt.args...)...)
+		if len(tt.msgs) == 0 {
+			if lines[0] != "" {
+				t.Errorf("%q: got %q, want nothing", tt.args, lines)
+			}
+			continue
+		}
+		if len(lines) != len(tt.msgs) {
+			t.Errorf("%q: got %q, want %q", tt.args, lines, tt.msgs)
+			continue
+		}
+		for i, msg := range tt.msgs {
+			if !strings.Contains(lines[i], msg) {
+				t.Errorf("%q: line %d is %q, want %q", tt.args, i, lines[i], msg)
+			}
+		}
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	for _, args := range [][]string{
+		{"-level", "loud"},
+		{"-topic", "[db"},
+		{"-field", "tenant"},
+		{"-since", "yesterday"},
+		{"-o", "xml"},
+		{filepath.Join(t.TempDir(), "missing.log")},
+	} {
+		if err := run(args, strings.NewReader(""), new(bytes.Buffer), io.Discard, nil); err == nil {
+			t.Errorf("run(%q) succeeded, want an error", args)
+		}
+	}
+}
+
+func TestRun_Files(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")
+	os.WriteFile(a, []byte(`{"level":"info","msg":"from a"}`+"\n"), 0o644)
+	os.WriteFile(b, []byte(`{"level":"info","msg":"from b"}`), 0o644)
+
+	var out bytes.Buffer
+	if err := run([]string{"-o", "json", a, b}, nil, &out, io.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"level":"info","msg":"from a"}` + "\n" + `{"level":"info","msg":"from b"}` + "\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"", time.Time{}},
+		{"15m", now.Add(-15 * time.Minute)},
+		{"2026-10-18T10:00:00Z", time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)},
+		{"2026-10-17", time.Date(2026, 10, 17, 0, 0, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		got, err := parseTime(tt.in, now)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseTime(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
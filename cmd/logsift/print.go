@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// formats a printer writes
+var formats = []string{"pretty", "text", "logfmt", "json"}
+
+// printer writes entries as 'pretty' (text in color), 'text', 'logfmt' or
+// 'json'
+type printer struct {
+	format string
+	// widest source so far, sources are padded to it
+	sourceWidth int
+	buf         bytes.Buffer
+}
+
+func (p *printer) print(w io.Writer, e *entry) error {
+	p.buf.Reset()
+	switch p.format {
+	case "json":
+		p.buf.Write(e.raw)
+	case "logfmt":
+		p.logfmt(e)
+	default:
+		p.text(e, p.format == "pretty")
+	}
+	p.buf.WriteByte('\n')
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+// text writes time, level, the aligned source, filters, message and fields
+func (p *printer) text(e *entry, color bool) {
+	levelColor := 0
+	if color {
+		levelColor = colorOf(e.rank)
+	}
+	timeText := e.timeText
+	if !e.time.IsZero() {
+		timeText = e.time.Format("2006-01-02 15:04:05.000")
+	}
+	p.buf.WriteString(timeText)
+	p.buf.WriteByte(' ')
+	p.colored(levelColor, fmt.Sprintf("%-4.4s", strings.ToUpper(e.level)))
+	if e.source != "" || p.sourceWidth > 0 {
+		if len(e.source) > p.sourceWidth {
+			p.sourceWidth = len(e.source)
+		}
+		p.buf.WriteByte(' ')
+		p.colored(colorIf(color, 90), fmt.Sprintf("%-*s", p.sourceWidth, e.source))
+	}
+	if len(e.filters) > 0 {
+		p.buf.WriteString(" [")
+		p.buf.WriteString(strings.Join(e.filters, ","))
+		p.buf.WriteByte(']')
+	}
+	p.buf.WriteByte(' ')
+	p.buf.WriteString(e.msg)
+	for _, key := range sortedKeys(e.fields) {
+		p.buf.WriteString("  ")
+		p.colored(levelColor, key)
+		p.buf.WriteByte('=')
+		p.buf.WriteString(value(e.fields[key]))
+	}
+}
+
+func (p *printer) logfmt(e *entry) {
+	pairs := []struct{ key, value string }{
+		{"time", e.timeText}, {"level", e.level}, {"msg", e.msg},
+		{"source", e.source}, {"filter", strings.Join(e.filters, ",")},
+	}
+	first := true
+	for _, pair := range pairs {
+		if pair.value == "" && pair.key != "msg" {
+			continue
+		}
+		if !first {
+			p.buf.WriteByte(' ')
+		}
+		first = false
+		p.buf.WriteString(pair.key + "=" + quote(pair.value))
+	}
+	for _, key := range sortedKeys(e.fields) {
+		p.buf.WriteString(" " + key + "=" + value(e.fields[key]))
+	}
+}
+
+func (p *printer) colored(color int, s string) {
+	if color == 0 {
+		p.buf.WriteString(s)
+		return
+	}
+	fmt.Fprintf(&p.buf, "\x1b[%dm%s\x1b[0m", color, s)
+}
+
+// colorOf returns the color logrus' text format uses for a level
+func colorOf(level logrus.Level) int {
+	switch {
+	case level <= logrus.ErrorLevel:
+		return 31
+	case level == logrus.WarnLevel:
+		return 33
+	case level == logrus.InfoLevel:
+		return 36
+	default:
+		return 37
+	}
+}
+
+func colorIf(color bool, c int) int {
+	if color {
+		return c
+	}
+	return 0
+}
+
+// value renders a field value, strings quoted if needed and everything else
+// as json
+func value(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return quote(s)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// quote quotes s if it is empty or holds spaces, '=', quotes or control
+// characters
+func quote(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == 0x7f {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+func sortedKeys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseEntry(t *testing.T) {
+	e, ok := parseEntry([]byte(`{"@timestamp":"2026-10-18T14:47:16Z","log.level":"WARN","message":"hi","source":{"file":"a.go","line":3},"filter":"db,auth","n":1}`))
+	if !ok {
+		t.Fatal("parseEntry failed")
+	}
+	if e.level != "warning" || e.msg != "hi" || e.source != "a.go:3" || e.time.IsZero() {
+		t.Errorf("got level %q, msg %q, source %q, time %v", e.level, e.msg, e.source, e.time)
+	}
+	if len(e.filters) != 2 || e.filters[0] != "db" || e.filters[1] != "auth" {
+		t.Errorf("got filters %q", e.filters)
+	}
+	if len(e.fields) != 1 || e.fields["n"] != 1.0 {
+		t.Errorf("got fields %v", e.fields)
+	}
+
+	for _, line := range []string{"", "panic: oops", "[1,2]", "null"} {
+		if _, ok := parseEntry([]byte(line)); ok {
+			t.Errorf("parseEntry(%q) succeeded", line)
+		}
+	}
+}
+
+func TestPrinter(t *testing.T) {
+	lines := []string{
+		`{"level":"info","msg":"started","source":" main.go:10 ","time":"2026-10-18T14:47:16Z"}`,
+		`{"level":"debug","msg":"query took","filter":"db","source":" db/conn.go:142 ","time":"2026-10-18T14:47:17Z","path":"/a b","n":2}`,
+		`{"level":"error","msg":"failed","source":" a.go:1 ","time":"2026-10-18T14:47:18Z"}`,
+	}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"text", "" +
+			"2026-10-18 14:47:16.000 INFO main.go:10 started\n" +
+			"2026-10-18 14:47:17.000 DEBU db/conn.go:142 [db] query took  n=2  path=\"/a b\"\n" +
+			"2026-10-18 14:47:18.000 ERRO a.go:1         failed\n"},
+		{"logfmt", "" +
+			"time=2026-10-18T14:47:16Z level=info msg=started source=main.go:10\n" +
+			"time=2026-10-18T14:47:17Z level=debug msg=\"query took\" source=db/conn.go:142 filter=db n=2 path=\"/a b\"\n" +
+			"time=2026-10-18T14:47:18Z level=error msg=failed source=a.go:1\n"},
+		{"pretty", "" +
+			"2026-10-18 14:47:16.000 \x1b[36mINFO\x1b[0m \x1b[90mmain.go:10\x1b[0m started\n" +
+			"2026-10-18 14:47:17.000 \x1b[37mDEBU\x1b[0m \x1b[90mdb/conn.go:142\x1b[0m [db] query took  \x1b[37mn\x1b[0m=2  \x1b[37mpath\x1b[0m=\"/a b\"\n" +
+			"2026-10-18 14:47:18.000 \x1b[31mERRO\x1b[0m \x1b[90ma.go:1        \x1b[0m failed\n"},
+	}
+	for _, tt := range tests {
+		p := &printer{format: tt.format}
+		var out bytes.Buffer
+		for _, line := range lines {
+			e, _ := parseEntry([]byte(line))
+			if err := p.print(&out, e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s:\ngot\n%s\nwant\n%s", tt.format, out.String(), tt.want)
+		}
+	}
+}
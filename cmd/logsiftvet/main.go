@@ -0,0 +1,66 @@
+// Command logsiftvet checks calls into logsift, see package logsiftcheck.
+//
+// Run it through go vet, optionally with a registry of known filter topics:
+//
+//	go vet -vettool=$(which logsiftvet) ./...
+//	go vet -vettool=$(which logsiftvet) -logsift.registry=$PWD/topics.txt ./...
+//
+// or write the registry, the filter topics used in a module:
+//
+//	logsiftvet topics ./... > topics.txt
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/jenish-rudani/logsift/analysis/logsiftcheck"
+	"golang.org/x/tools/go/analysis/unitchecker"
+	"golang.org/x/tools/go/packages"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "topics" {
+		if err := listTopics(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "logsiftvet:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	unitchecker.Main(logsiftcheck.Analyzer)
+}
+
+// listTopics prints the filter topics of the packages matching patterns, one
+// per line
+func listTopics(patterns []string) error {
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	cfg := &packages.Config{
+		Mode:  packages.NeedName | packages.NeedImports | packages.NeedDeps | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo,
+		Tests: true,
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return err
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		return fmt.Errorf("packages contain errors")
+	}
+	seen := make(map[string]bool)
+	for _, pkg := range pkgs {
+		for _, topic := range logsiftcheck.Topics(pkg.Syntax, pkg.TypesInfo) {
+			seen[topic] = true
+		}
+	}
+	topics := make([]string, 0, len(seen))
+	for topic := range seen {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	for _, topic := range topics {
+		fmt.Println(topic)
+	}
+	return nil
+}
@@ -0,0 +1,496 @@
+package logsift
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.yaml.in/yaml/v2"
+)
+
+var ConfigReloadCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "service_log_config_reload_counter",
+	Help: "count of log config file loads by result",
+}, []string{"result"})
+
+// Config is the content of a config file loaded via LoadConfig. It is the
+// whole configuration, settings left out of the file take their defaults.
+type Config struct {
+	Level            string `json:"level" yaml:"level" toml:"level"`
+	Levels           string `json:"levels" yaml:"levels" toml:"levels"` // by package, "none" removes them
+	V                *int   `json:"v" yaml:"v" toml:"v"`
+	VModule          string `json:"vmodule" yaml:"vmodule" toml:"vmodule"` // "none" removes it
+	Format           string `json:"format" yaml:"format" toml:"format"`
+	SourceFormat     string `json:"sourceFormat" yaml:"sourceFormat" toml:"sourceFormat"`
+	SourceStructured *bool  `json:"sourceStructured" yaml:"sourceStructured" toml:"sourceStructured"`
+	Sanitize         string `json:"sanitize" yaml:"sanitize" toml:"sanitize"`
+	// duration or "off"
+	Dedup string `json:"dedup" yaml:"dedup" toml:"dedup"`
+	// enabled filters, an empty list clears them
+	Filters          []string `json:"filters" yaml:"filters" toml:"filters"`
+	AllowEmptyFilter *bool    `json:"allowEmptyFilter" yaml:"allowEmptyFilter" toml:"allowEmptyFilter"`
+	// expression enabling filtered entries, "none" removes it
+	FilterExpr string `json:"filterExpr" yaml:"filterExpr" toml:"filterExpr"`
+	// field carrying the topics of filtered entries, "none" removes it
+	FilterField string `json:"filterField" yaml:"filterField" toml:"filterField"`
+	// key patterns of the built-in 'keys' rule
+	RedactKeys []string `json:"redactKeys" yaml:"redactKeys" toml:"redactKeys"`
+	// enabled redaction rules, an empty list disables all
+	RedactRules []string `json:"redactRules" yaml:"redactRules" toml:"redactRules"`
+	// additional redaction rules
+	Redaction []RedactionConfig `json:"redaction" yaml:"redaction" toml:"redaction"`
+	// "perSecond[:burst]" per filter
+	RateLimits map[string]string `json:"rateLimits" yaml:"rateLimits" toml:"rateLimits"`
+	// "first:thereafter:tick" or "off"
+	Sampling string       `json:"sampling" yaml:"sampling" toml:"sampling"`
+	Sinks    []SinkConfig `json:"sinks" yaml:"sinks" toml:"sinks"`
+}
+
+// RedactionConfig declares a redaction rule in a config file.
+type RedactionConfig struct {
+	Name    string   `json:"name" yaml:"name" toml:"name"`
+	Keys    []string `json:"keys" yaml:"keys" toml:"keys"`
+	Pattern string   `json:"pattern" yaml:"pattern" toml:"pattern"`
+}
+
+// SinkConfig declares a sink in a config file, see AddSink.
+type SinkConfig struct {
+	Name string `json:"name" yaml:"name" toml:"name"`
+	// "stdout", "stderr" or a file to append to
+	Path     string `json:"path" yaml:"path" toml:"path"`
+	Format   string `json:"format" yaml:"format" toml:"format"`
+	Sanitize string `json:"sanitize" yaml:"sanitize" toml:"sanitize"`
+	// duration or "off"
+	Dedup string `json:"dedup" yaml:"dedup" toml:"dedup"`
+}
+
+// ParseConfig decodes a config file, the format is picked by the extension
+// of path: .yaml, .yml, .json or .toml. Unknown keys are an error.
+func ParseConfig(path string, data []byte) (*Config, error) {
+	c := &Config{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.UnmarshalStrict(data, c); err != nil {
+			return nil, err
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(c); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return nil, err
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("unknown key %q", undecoded[0].String())
+		}
+	default:
+		return nil, fmt.Errorf("unknown config format %q", filepath.Ext(path))
+	}
+	return c, nil
+}
+
+// values returns the config as Handler parameters, with the defaults of the
+// settings left out
+func (c *Config) values() map[string]string {
+	v := map[string]string{
+		"level":        c.Level,
+		"levels":       c.Levels,
+		"vmodule":      c.VModule,
+		"format":       c.Format,
+		"sourceFormat": c.SourceFormat,
+		"sanitize":     c.Sanitize,
+		"dedup":        c.Dedup,
+		"sampling":     c.Sampling,
+		"filterExpr":   c.FilterExpr,
+		"filterField":  c.FilterField,
+	}
+	if c.V != nil {
+		v["v"] = strconv.Itoa(*c.V)
+	}
+	if c.SourceStructured != nil {
+		v["sourceStructured"] = strconv.FormatBool(*c.SourceStructured)
+	}
+	if c.Filters != nil {
+		if len(c.Filters) == 0 {
+			v["resetFilter"] = "true"
+		} else {
+			v["filter"] = strings.Join(c.Filters, ",")
+		}
+	}
+	if c.AllowEmptyFilter != nil {
+		v["allowEmptyFilter"] = strconv.FormatBool(*c.AllowEmptyFilter)
+	}
+	if len(c.RedactKeys) > 0 {
+		v["redactKeys"] = strings.Join(c.RedactKeys, ",")
+	}
+	if c.RedactRules != nil {
+		v["redactRules"] = "none"
+		if len(c.RedactRules) > 0 {
+			v["redactRules"] = strings.Join(c.RedactRules, ",")
+		}
+	}
+	if c.RateLimits != nil {
+		v["rateLimit"] = "off"
+		if len(c.RateLimits) > 0 {
+			limits := make([]string, 0, len(c.RateLimits))
+			for filter, limit := range c.RateLimits {
+				limits = append(limits, filter+":"+limit)
+			}
+			sort.Strings(limits)
+			v["rateLimit"] = strings.Join(limits, ",")
+		}
+	}
+	for name, value := range configDefaults() {
+		if v[name] == "" {
+			v[name] = value
+		}
+	}
+	if v["filter"] != "" {
+		delete(v, "resetFilter")
+	}
+	if c.RedactRules == nil {
+		// the default rules and those the file declares
+		for _, rc := range c.Redaction {
+			v["redactRules"] += "," + rc.Name
+		}
+	}
+	return v
+}
+
+// configDefaults returns the values of the settings a config file leaves out
+func configDefaults() map[string]string {
+	var keys, rules []string
+	for _, rule := range DefaultRedactionRules() {
+		if rule.Name == "keys" {
+			keys = rule.Keys
+		}
+		if !rule.Disabled {
+			rules = append(rules, rule.Name)
+		}
+	}
+	return map[string]string{
+		"level":            "info",
+		"levels":           "none",
+		"v":                "0",
+		"vmodule":          "none",
+		"format":           "text",
+		"sourceFormat":     "short",
+		"sourceStructured": "false",
+		"sanitize":         "auto",
+		"dedup":            "off",
+		"resetFilter":      "true",
+		"allowEmptyFilter": "false",
+		"filterExpr":       "none",
+		"filterField":      "none",
+		"redactKeys":       strings.Join(keys, ","),
+		"redactRules":      strings.Join(rules, ","),
+		"rateLimit":        "off",
+		"sampling":         "off",
+	}
+}
+
+// redactionRules compiles the declared redaction rules and checks that the
+// enabled rules exist
+func (c *Config) redactionRules() ([]RedactionRule, error) {
+	known := make(map[string]bool)
+	for _, rule := range *redaction.rules.Load() {
+		known[rule.Name] = true
+	}
+	rules := make([]RedactionRule, 0, len(c.Redaction))
+	for _, rc := range c.Redaction {
+		rule := RedactionRule{Name: rc.Name, Keys: rc.Keys}
+		if rc.Pattern != "" {
+			var err error
+			if rule.Pattern, err = regexp.Compile(rc.Pattern); err != nil {
+				return nil, fmt.Errorf("redaction rule %q: %w", rc.Name, err)
+			}
+		}
+		if err := validRedactionRule(rule); err != nil {
+			return nil, err
+		}
+		known[rule.Name] = true
+		rules = append(rules, rule)
+	}
+	for _, name := range c.RedactRules {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown redaction rule %q", name)
+		}
+	}
+	return rules, nil
+}
+
+// openSinks validates the declared sinks and opens those that changed since
+// prev, or all of them if reopen is set
+func (c *Config) openSinks(prev *Config, reopen bool) (map[string]io.Writer, error) {
+	previous := make(map[string]SinkConfig)
+	for _, sc := range prev.Sinks {
+		previous[sc.Name] = sc
+	}
+	outs := make(map[string]io.Writer)
+	for _, sc := range c.Sinks {
+		var err error
+		switch {
+		case sc.Name == "":
+			err = fmt.Errorf("sink needs a name")
+		case sc.Name == defaultSink.name:
+			err = fmt.Errorf("sink name %q is reserved for the main output", sc.Name)
+		case outs[sc.Name] != nil:
+			err = fmt.Errorf("duplicate sink %q", sc.Name)
+		case sc.Path == "":
+			err = fmt.Errorf("sink %q needs a path", sc.Name)
+		case sc.Format != "" && !knownFormat(sc.Format):
+			err = fmt.Errorf("sink %q: unknown format %q", sc.Name, sc.Format)
+		case sc.Sanitize != "" && sanitizeMode(sc.Sanitize) != sc.Sanitize:
+			err = fmt.Errorf("sink %q: unknown sanitize mode %q", sc.Name, sc.Sanitize)
+		}
+		if err == nil && sc.Dedup != "" {
+			if _, err = parseWindow(sc.Dedup); err != nil {
+				err = fmt.Errorf("sink %q: %w", sc.Name, err)
+			}
+		}
+		if err == nil {
+			// unchanged sinks are kept open
+			out := io.Discard
+			if reopen || previous[sc.Name] != sc {
+				out, err = openSinkPath(sc.Path)
+			}
+			outs[sc.Name] = out
+		}
+		if err != nil {
+			closeSinkOutputs(outs)
+			return nil, err
+		}
+	}
+	for name, out := range outs {
+		if out == io.Discard {
+			delete(outs, name)
+		}
+	}
+	return outs, nil
+}
+
+func openSinkPath(path string) (io.Writer, error) {
+	switch path {
+	case "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+}
+
+func closeSinkOutputs(outs map[string]io.Writer) {
+	for _, out := range outs {
+		if f, ok := out.(*os.File); ok && f != os.Stdout && f != os.Stderr {
+			f.Close()
+		}
+	}
+}
+
+// configWatcher polls the loaded config file and applies its changes
+type configWatcher struct {
+	sync.Mutex
+	path     string
+	interval time.Duration
+	stop     chan struct{}
+	// last content read, applied or rejected
+	data []byte
+	// last applied config
+	applied *Config
+}
+
+var watcher = &configWatcher{interval: 2 * time.Second, applied: &Config{}}
+
+// LoadConfig applies the config file at path and watches it, applying changes
+// as the file is modified. A file that fails to parse or holds an invalid
+// value is rejected as a whole and logged, the last good config stays.
+func LoadConfig(path string) error {
+	watcher.Lock()
+	defer watcher.Unlock()
+	watcher.stopWatching()
+	watcher.path = path
+	if err := watcher.reload(true); err != nil {
+		return err
+	}
+	watcher.watch()
+	return nil
+}
+
+// ReloadConfig re-reads the loaded config file and reopens its file sinks.
+func ReloadConfig() error {
+	watcher.Lock()
+	defer watcher.Unlock()
+	if watcher.path == "" {
+		return fmt.Errorf("no config loaded")
+	}
+	return watcher.reload(true)
+}
+
+// StopConfigWatch stops watching the loaded config file, the config stays.
+func StopConfigWatch() {
+	watcher.Lock()
+	defer watcher.Unlock()
+	watcher.stopWatching()
+}
+
+// set how often the loaded config file is checked for changes, 0 stops watching
+func SetConfigPollInterval(interval time.Duration) {
+	watcher.Lock()
+	defer watcher.Unlock()
+	watcher.interval = interval
+	if watcher.stop != nil {
+		watcher.stopWatching()
+		watcher.watch()
+	}
+}
+
+// watch starts polling, the watcher must be locked
+func (w *configWatcher) watch() {
+	if w.interval <= 0 {
+		return
+	}
+	stop := make(chan struct{})
+	w.stop = stop
+	go func(interval time.Duration) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			w.Lock()
+			select {
+			case <-stop:
+			default:
+				w.reload(false)
+			}
+			w.Unlock()
+		}
+	}(w.interval)
+}
+
+func (w *configWatcher) stopWatching() {
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+}
+
+// reload reads and applies the config file if it changed or force is set
+func (w *configWatcher) reload(force bool) error {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return w.reject(err)
+	}
+	if !force && bytes.Equal(data, w.data) {
+		return nil
+	}
+	w.data = data
+	c, err := ParseConfig(w.path, data)
+	if err == nil {
+		err = w.apply(c, force)
+	}
+	if err != nil {
+		return w.reject(err)
+	}
+	ConfigReloadCounter.WithLabelValues("success").Inc()
+	return nil
+}
+
+func (w *configWatcher) reject(err error) error {
+	ConfigReloadCounter.WithLabelValues("failure").Inc()
+	err = fmt.Errorf("rejected log config %s: %w", w.path, err)
+	defaultLogger.entry.Error(err)
+	return err
+}
+
+// apply validates c and applies it as a whole, settings left out of c return
+// to their defaults. Only what changed since the last applied config is
+// logged.
+func (w *configWatcher) apply(c *Config, reopen bool) error {
+	values, prevValues := c.values(), w.applied.values()
+	changes, err := parseSettings(func(name string) string { return values[name] })
+	if err != nil {
+		return err
+	}
+	rules, err := c.redactionRules()
+	if err != nil {
+		return err
+	}
+	outs, err := c.openSinks(w.applied, reopen)
+	if err != nil {
+		return err
+	}
+
+	previous := make(map[string]RedactionConfig)
+	for _, rc := range w.applied.Redaction {
+		previous[rc.Name] = rc
+	}
+	declared := make(map[string]bool)
+	for i, rule := range rules {
+		declared[rule.Name] = true
+		if prev, ok := previous[rule.Name]; !ok || !reflect.DeepEqual(prev, c.Redaction[i]) {
+			if err := AddRedactionRule(rule); err != nil {
+				return err
+			}
+		}
+	}
+	for name := range previous {
+		if !declared[name] {
+			RemoveRedactionRule(name)
+		}
+	}
+
+	declared = make(map[string]bool)
+	for _, sc := range c.Sinks {
+		declared[sc.Name] = true
+	}
+	for _, sc := range w.applied.Sinks {
+		if !declared[sc.Name] {
+			RemoveSink(sc.Name)
+		}
+	}
+	for _, sc := range c.Sinks {
+		if out, ok := outs[sc.Name]; ok {
+			window, _ := parseWindow(sc.Dedup)
+			opts := []SinkOption{SinkSanitize(sc.Sanitize), SinkDedup(window)}
+			if closer, ok := out.(io.Closer); ok && out != os.Stdout && out != os.Stderr {
+				opts = append(opts, sinkCloser(closer))
+			}
+			AddSink(sc.Name, out, sc.Format, opts...)
+		}
+	}
+
+	w.applied = c
+	for _, change := range changes {
+		changes := settingChanges{change}
+		if change.value != prevValues[change.name] {
+			err = changes.apply()
+		} else {
+			err = changes.set()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
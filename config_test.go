@@ -0,0 +1,305 @@
+package logsift
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// resetConfig stops watching and forgets the loaded config.
+func resetConfig(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		StopConfigWatch()
+		watcher.Lock()
+		for _, sc := range watcher.applied.Sinks {
+			RemoveSink(sc.Name)
+		}
+		for _, rc := range watcher.applied.Redaction {
+			RemoveRedactionRule(rc.Name)
+		}
+		watcher.path, watcher.data, watcher.applied = "", nil, &Config{}
+		watcher.interval = 2 * time.Second
+		watcher.Unlock()
+	})
+}
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseConfig_Formats(t *testing.T) {
+	structured := true
+	want := &Config{
+		Level:            "warn",
+		Format:           "json",
+		SourceStructured: &structured,
+		Filters:          []string{"db", "auth"},
+		RateLimits:       map[string]string{"db": "50:100"},
+		Redaction:        []RedactionConfig{{Name: "ssn", Pattern: `\d{3}-\d{2}-\d{4}`}},
+		Sinks:            []SinkConfig{{Name: "audit", Path: "audit.log", Format: "json"}},
+	}
+	files := map[string]string{
+		"config.yaml": `
+level: warn
+format: json
+sourceStructured: true
+filters: [db, auth]
+rateLimits:
+  db: "50:100"
+redaction:
+  - name: ssn
+    pattern: '\d{3}-\d{2}-\d{4}'
+sinks:
+  - name: audit
+    path: audit.log
+    format: json
+`,
+		"config.json": `{
+  "level": "warn",
+  "format": "json",
+  "sourceStructured": true,
+  "filters": ["db", "auth"],
+  "rateLimits": {"db": "50:100"},
+  "redaction": [{"name": "ssn", "pattern": "\\d{3}-\\d{2}-\\d{4}"}],
+  "sinks": [{"name": "audit", "path": "audit.log", "format": "json"}]
+}`,
+		"config.toml": `
+level = "warn"
+format = "json"
+sourceStructured = true
+filters = ["db", "auth"]
+
+[rateLimits]
+db = "50:100"
+
+[[redaction]]
+name = "ssn"
+pattern = '\d{3}-\d{2}-\d{4}'
+
+[[sinks]]
+name = "audit"
+path = "audit.log"
+format = "json"
+`,
+	}
+	for path, content := range files {
+		c, err := ParseConfig(path, []byte(content))
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if !reflect.DeepEqual(c, want) {
+			t.Errorf("%s: expected %+v, got %+v", path, want, c)
+		}
+	}
+}
+
+func TestParseConfig_UnknownKeys(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": "levle: debug\n",
+		"config.json": `{"levle": "debug"}`,
+		"config.toml": `levle = "debug"`,
+		"config.ini":  "level=debug",
+	}
+	for path, content := range files {
+		if _, err := ParseConfig(path, []byte(content)); err == nil {
+			t.Errorf("%s: expected error", path)
+		}
+	}
+}
+
+func TestLoadConfig_Applies(t *testing.T) {
+	buf := setupTest(t)
+	resetConfig(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log.yaml")
+	auditPath := filepath.Join(dir, "audit.log")
+	writeConfig(t, path, `
+level: info
+sourceFormat: none
+filters: [db]
+redaction:
+  - name: ssn
+    pattern: '\d{3}-\d{2}-\d{4}'
+sinks:
+  - name: audit
+    path: `+auditPath+`
+    format: json
+`)
+
+	if err := LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	if GetLevel() != "info" || GetSourceFormat() != "none" {
+		t.Errorf("unexpected level %q and source format %q", GetLevel(), GetSourceFormat())
+	}
+
+	buf.Reset()
+	DebugFilter("db", "not at info")
+	InfoFilter("db", "ssn 123-45-6789")
+	InfoFilter("cache", "filtered")
+	if got := countLines(buf.String()); got != 1 {
+		t.Fatalf("expected 1 line, got %s", buf.String())
+	}
+	if strings.Contains(buf.String(), "123-45-6789") {
+		t.Errorf("expected ssn redacted, got %s", buf.String())
+	}
+	audit, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(audit), `"msg":"ssn [REDACTED]"`) {
+		t.Errorf("expected entry in file sink, got %s", audit)
+	}
+}
+
+func TestLoadConfig_RejectsInvalid(t *testing.T) {
+	setupTest(t)
+	resetConfig(t)
+	path := filepath.Join(t.TempDir(), "log.json")
+	writeConfig(t, path, `{"level": "warn", "filters": ["db"]}`)
+	if err := LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+
+	failures := testutil.ToFloat64(ConfigReloadCounter.WithLabelValues("failure"))
+	invalid := []string{
+		`{"level": "info", "format": "yaml"}`,
+		`{"level": "info", "sampling": "x"}`,
+		`{"level": "info", "redactRules": ["nope"]}`,
+		`{"level": "info", "sinks": [{"name": "a"}]}`,
+		`{"level": "info", "sinks": [{"name": "default", "path": "stdout"}]}`,
+		`{"level": "info"`,
+	}
+	for _, content := range invalid {
+		writeConfig(t, path, content)
+		if err := ReloadConfig(); err == nil {
+			t.Errorf("expected %s to be rejected", content)
+		}
+	}
+	if got := GetLevel(); got != "warning" {
+		t.Errorf("expected last good level to stay, got %q", got)
+	}
+	if !Default().FiltersAllow("db") {
+		t.Error("expected last good filters to stay")
+	}
+	if got := testutil.ToFloat64(ConfigReloadCounter.WithLabelValues("failure")) - failures; got != float64(len(invalid)) {
+		t.Errorf("expected %d failures counted, got %v", len(invalid), got)
+	}
+}
+
+func TestLoadConfig_HotReload(t *testing.T) {
+	buf := setupTest(t)
+	resetConfig(t)
+	path := filepath.Join(t.TempDir(), "log.toml")
+	writeConfig(t, path, `level = "warn"`)
+	SetConfigPollInterval(10 * time.Millisecond)
+	if err := LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+
+	successes := testutil.ToFloat64(ConfigReloadCounter.WithLabelValues("success"))
+	writeConfig(t, path, "level = \"debug\"\nfilters = [\"db\"]")
+	deadline := time.Now().Add(2 * time.Second)
+	for GetLevel() != "debug" && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if GetLevel() != "debug" {
+		t.Fatalf("expected reload to set debug, got %q", GetLevel())
+	}
+	if testutil.ToFloat64(ConfigReloadCounter.WithLabelValues("success")) <= successes {
+		t.Error("expected reload to be counted")
+	}
+	if !strings.Contains(buf.String(), "updating level to debug") {
+		t.Errorf("expected change to be logged, got %s", buf.String())
+	}
+
+	// the file is the whole config, settings left out return to their defaults
+	SetFormat("nocolor")
+	writeConfig(t, path, "level = \"debug\"\nfilters = []")
+	deadline = time.Now().Add(2 * time.Second)
+	for Default().FiltersAllow("db") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if Default().FiltersAllow("db") {
+		t.Error("expected filters to be cleared")
+	}
+	if GetFormat() != "text" {
+		t.Errorf("expected format to return to its default, got %q", GetFormat())
+	}
+}
+
+func TestLoadConfig_RemovedKeysReturnToDefaults(t *testing.T) {
+	buf := setupTest(t)
+	resetConfig(t)
+	path := filepath.Join(t.TempDir(), "log.yaml")
+	writeConfig(t, path, "level: warn\nformat: json\nfilters: [db]\nsampling: \"10:5:1s\"\nredactRules: [keys]\n")
+	if err := LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfig(t, path, "format: json\n")
+	buf.Reset()
+	if err := ReloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if GetLevel() != "info" || Default().FiltersAllow("db") {
+		t.Errorf("expected level and filters to return to their defaults, got %q and %v", GetLevel(), GetFilters())
+	}
+	if first, _, _ := GetSampling(); first != 0 {
+		t.Errorf("expected sampling off, got first %d", first)
+	}
+	if rules := GetRedactionRules(); !reflect.DeepEqual(rules, []string{"keys", "jwt"}) {
+		t.Errorf("expected default redaction rules, got %v", rules)
+	}
+	// only the changes are logged, not the defaults that stayed
+	if strings.Contains(buf.String(), "updating format") || !strings.Contains(buf.String(), "updating level to info") {
+		t.Errorf("unexpected change log %s", buf.String())
+	}
+}
+
+func TestLoadConfig_RemovesSinks(t *testing.T) {
+	setupTest(t)
+	resetConfig(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log.yaml")
+	auditPath := filepath.Join(dir, "audit.log")
+	writeConfig(t, path, "sinks:\n  - name: audit\n    path: "+auditPath+"\n")
+	if err := LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	Info("first")
+	writeConfig(t, path, "level: debug\n")
+	if err := ReloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	Info("second")
+	audit, _ := os.ReadFile(auditPath)
+	if !strings.Contains(string(audit), "first") || strings.Contains(string(audit), "second") {
+		t.Errorf("expected sink to be removed, got %s", audit)
+	}
+}
+
+func TestHandler_InvalidAppliesNothing(t *testing.T) {
+	setupTest(t)
+	req := httptest.NewRequest("GET", "/log?level=warn&sourceStructured=notabool", nil)
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, req)
+	if got := GetLevel(); got != "debug" {
+		t.Errorf("expected level to stay 'debug', got %q", got)
+	}
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "sourceStructured") {
+		t.Errorf("expected a 400 naming the setting, got %d %q", rec.Code, rec.Body.String())
+	}
+}
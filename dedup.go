@@ -0,0 +1,147 @@
+package logsift
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// deduper collapses entries that repeat the previous entry of a sink, the way
+// syslog does. A run of repeats is held back and written as a single "last
+// message repeated N times" entry once a different entry arrives or the
+// window passes. All methods are called with the sink locked.
+type deduper struct {
+	window time.Duration
+	key    string
+	// the entry that started the current run
+	last        *logrus.Entry
+	count       int
+	first, most time.Time
+	timer       *time.Timer
+	// bumped on every flush so a stale timer does not flush a newer run
+	gen uint64
+}
+
+// SinkDedup collapses repeated entries of a sink within 'window', see SetDedup.
+func SinkDedup(window time.Duration) SinkOption {
+	return func(s *sink) {
+		s.setDedup(window)
+	}
+}
+
+// collapse entries repeating the previous entry of the main output into one
+// 'last message repeated N times' entry, written when a different entry
+// arrives or after 'window'. 0 turns collapsing off
+func SetDedup(window time.Duration) {
+	defaultSink.Lock()
+	defer defaultSink.Unlock()
+	defaultSink.setDedup(window)
+}
+
+// get the dedup window of the main output, 0 if off
+func GetDedup() time.Duration {
+	defaultSink.Lock()
+	defer defaultSink.Unlock()
+	if defaultSink.dedup == nil {
+		return 0
+	}
+	return defaultSink.dedup.window
+}
+
+// setDedup flushes a pending run and replaces the deduper
+func (s *sink) setDedup(window time.Duration) {
+	if s.dedup != nil {
+		s.dedup.flush(s, s.out)
+	}
+	s.dedup = nil
+	if window > 0 {
+		s.dedup = &deduper{window: window}
+	}
+}
+
+// repeat reports whether entry repeats the previous entry and is held back.
+// An entry ending a run flushes the run to w first, as does a fatal or panic
+// entry, which is never held back.
+func (d *deduper) repeat(s *sink, w io.Writer, entry *logrus.Entry) bool {
+	if entry.Level <= logrus.FatalLevel {
+		d.flush(s, w)
+		return false
+	}
+	key := dedupKey(entry)
+	// a run without repeats ends with the window too
+	if d.last != nil && key == d.key && (d.count > 0 || entry.Time.Sub(d.last.Time) < d.window) {
+		if d.count == 0 {
+			d.first = entry.Time
+			gen := d.gen
+			d.timer = time.AfterFunc(d.window, func() {
+				s.Lock()
+				defer s.Unlock()
+				if d.gen == gen {
+					d.flush(s, s.out)
+				}
+			})
+		}
+		d.count++
+		d.most = entry.Time
+		return true
+	}
+	d.flush(s, w)
+	e := *entry
+	e.Buffer = nil
+	d.key, d.last = key, &e
+	return false
+}
+
+// flush writes the summary of a pending run to w and ends the run
+func (d *deduper) flush(s *sink, w io.Writer) {
+	d.gen++
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	last := d.last
+	d.key, d.last = "", nil
+	if d.count == 0 {
+		return
+	}
+	e := *last
+	e.Time = d.most
+	e.Message = fmt.Sprintf("last message repeated %d times", d.count)
+	e.Data = make(logrus.Fields, len(last.Data)+4)
+	for k, v := range last.Data {
+		e.Data[k] = v
+	}
+	e.Data["repeated"] = d.count
+	e.Data["repeatedMsg"] = last.Message
+	e.Data["firstRepeat"] = d.first.Format(time.RFC3339Nano)
+	e.Data["lastRepeat"] = d.most.Format(time.RFC3339Nano)
+	d.count = 0
+	s.emit(w, &e)
+}
+
+// dedupKey identifies entries with the same level, message and fields. The
+// source is left out, it is logsift's metadata rather than part of the entry.
+func dedupKey(entry *logrus.Entry) string {
+	keys := make([]string, 0, len(entry.Data))
+	for k := range entry.Data {
+		if k != "source" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(entry.Level.String())
+	b.WriteByte(0)
+	b.WriteString(entry.Message)
+	for _, k := range keys {
+		b.WriteByte(0)
+		b.WriteString(k)
+		b.WriteByte('=')
+		fmt.Fprint(&b, entry.Data[k])
+	}
+	return b.String()
+}
@@ -0,0 +1,207 @@
+package logsift
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// parseLogEntries parses every JSON log line in the buffer.
+func parseLogEntries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+	for dec.More() {
+		var entry map[string]interface{}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatalf("failed to parse log output as JSON: %v\nraw: %s", err, buf.String())
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestDedup_CollapsesRepeats(t *testing.T) {
+	buf := setupTest(t)
+	SetDedup(time.Hour)
+
+	for i := 0; i < 5; i++ {
+		Warn("dependency down")
+	}
+	Info("dependency up")
+
+	entries := parseLogEntries(t, buf)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 lines, got %d: %s", len(entries), buf.String())
+	}
+	if entries[0]["msg"] != "dependency down" {
+		t.Errorf("expected first entry to be written, got %v", entries[0]["msg"])
+	}
+	repeat := entries[1]
+	if repeat["msg"] != "last message repeated 4 times" || repeat["repeated"] != float64(4) {
+		t.Errorf("unexpected repeat entry %v", repeat)
+	}
+	if repeat["level"] != "warning" || repeat["repeatedMsg"] != "dependency down" {
+		t.Errorf("expected repeat entry to keep level and message, got %v", repeat)
+	}
+	if repeat["firstRepeat"] == nil || repeat["lastRepeat"] == nil {
+		t.Errorf("expected first and last timestamps, got %v", repeat)
+	}
+	if entries[2]["msg"] != "dependency up" {
+		t.Errorf("expected new message last, got %v", entries[2]["msg"])
+	}
+}
+
+func TestDedup_FlushesAfterWindow(t *testing.T) {
+	buf := setupTest(t)
+	SetDedup(20 * time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		Warn("flapping")
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	// the summary is written from a timer under the sink lock
+	defaultSink.Lock()
+	entries := parseLogEntries(t, buf)
+	defaultSink.Unlock()
+	if len(entries) != 2 {
+		t.Fatalf("expected entry and repeat summary, got %d: %s", len(entries), buf.String())
+	}
+	if entries[1]["repeated"] != float64(2) {
+		t.Errorf("expected 2 repeats, got %v", entries[1]["repeated"])
+	}
+}
+
+func TestDedup_RepeatAfterWindow(t *testing.T) {
+	buf := setupTest(t)
+	SetDedup(20 * time.Millisecond)
+
+	Warn("flapping")
+	Warn("flapping")
+	time.Sleep(60 * time.Millisecond)
+	Warn("flapping")
+	Info("once")
+	time.Sleep(30 * time.Millisecond)
+	Info("once")
+
+	defaultSink.Lock()
+	entries := parseLogEntries(t, buf)
+	defaultSink.Unlock()
+	var msgs []interface{}
+	for _, e := range entries {
+		msgs = append(msgs, e["msg"])
+	}
+	want := []interface{}{"flapping", "last message repeated 1 times", "flapping", "once", "once"}
+	if !reflect.DeepEqual(msgs, want) {
+		t.Errorf("expected repeats after the window to be written, got %v", msgs)
+	}
+}
+
+func TestDedup_PanicNotHeld(t *testing.T) {
+	buf := setupTest(t)
+	SetDedup(time.Hour)
+
+	Warn("down")
+	Warn("down")
+	for i := 0; i < 2; i++ {
+		func() {
+			defer func() { recover() }()
+			Panic("boom")
+		}()
+	}
+
+	var msgs []interface{}
+	for _, e := range parseLogEntries(t, buf) {
+		msgs = append(msgs, e["msg"])
+	}
+	want := []interface{}{"down", "last message repeated 1 times", "boom", "boom"}
+	if !reflect.DeepEqual(msgs, want) {
+		t.Errorf("expected run flushed and panics written, got %v", msgs)
+	}
+}
+
+func TestDedup_AcrossDerivedLoggers(t *testing.T) {
+	buf := setupTest(t)
+	SetDedup(time.Hour)
+
+	With("peer", "db1").Warn("unreachable")
+	With("peer", "db1").Warn("unreachable")
+	With("peer", "db2").Warn("unreachable")
+
+	entries := parseLogEntries(t, buf)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 lines, got %d: %s", len(entries), buf.String())
+	}
+	if entries[1]["repeated"] != float64(1) || entries[1]["peer"] != "db1" {
+		t.Errorf("expected repeat of db1 entry, got %v", entries[1])
+	}
+	if entries[2]["peer"] != "db2" {
+		t.Errorf("expected different fields not to collapse, got %v", entries[2])
+	}
+}
+
+func TestDedup_ConcurrentWriters(t *testing.T) {
+	buf := setupTest(t)
+	SetDedup(time.Hour)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				Warn("storm")
+			}
+		}()
+	}
+	wg.Wait()
+	SetDedup(0) // flushes the pending run
+
+	entries := parseLogEntries(t, buf)
+	if len(entries) != 2 {
+		t.Fatalf("expected entry and repeat summary, got %d", len(entries))
+	}
+	if entries[1]["repeated"] != float64(799) {
+		t.Errorf("expected 799 repeats, got %v", entries[1]["repeated"])
+	}
+}
+
+func TestDedup_PerSink(t *testing.T) {
+	buf := setupTest(t)
+	collapsed := &bytes.Buffer{}
+	AddSink("collapsed", collapsed, "json", SinkDedup(time.Hour))
+	t.Cleanup(func() { RemoveSink("collapsed") })
+
+	Info("again")
+	Info("again")
+	RemoveSink("collapsed")
+
+	if got := len(parseLogEntries(t, buf)); got != 2 {
+		t.Errorf("expected main output to keep repeats, got %d lines", got)
+	}
+	entries := parseLogEntries(t, collapsed)
+	if len(entries) != 2 || entries[1]["repeated"] != float64(1) {
+		t.Errorf("expected sink to collapse and flush on removal, got %v", entries)
+	}
+}
+
+func TestHandler_Dedup(t *testing.T) {
+	setupTest(t)
+
+	req := httptest.NewRequest("GET", "/log?dedup=10s", nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if got := GetDedup(); got != 10*time.Second {
+		t.Errorf("expected dedup 10s, got %s", got)
+	}
+
+	req = httptest.NewRequest("GET", "/log?dedup=off", nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if got := GetDedup(); got != 0 {
+		t.Errorf("expected dedup off, got %s", got)
+	}
+}
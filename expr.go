@@ -0,0 +1,418 @@
+package logsift
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// filterExpr is a compiled filter expression such as
+//
+//	topic:db.* && tenant == "acme" && duration_ms > 100
+//
+// It is evaluated for filtered entries the topic filters do not allow, against
+// the entry's filters, level and fields. Operands are 'topic:glob', matching
+// any filter of the entry in path.Match syntax, and comparisons of a field or
+// 'level' with ==, !=, <, <=, >, >= or =~ (regexp). Comparisons combine with
+// &&, || and !, and group with parentheses. A missing field compares false.
+type filterExpr struct {
+	text string
+	root exprNode
+}
+
+type exprNode interface {
+	eval(level logrus.Level, topics []string, fields logrus.Fields) bool
+}
+
+// CompileFilterExpr checks the syntax of a filter expression, see SetFilterExpr.
+func CompileFilterExpr(text string) error {
+	_, err := compileFilterExpr(text)
+	return err
+}
+
+func compileFilterExpr(text string) (*filterExpr, error) {
+	p := &exprParser{lex: exprLexer{src: text}}
+	p.next()
+	root, err := p.parseOr()
+	if err == nil && (p.err != nil || p.tok.kind != tokEOF) {
+		err = p.errorf("unexpected %s", p.tok)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("filter expression %q: %w", text, err)
+	}
+	return &filterExpr{text: text, root: root}, nil
+}
+
+func (x *filterExpr) matches(level logrus.Level, topics []string, fields logrus.Fields) bool {
+	return x.root.eval(level, topics, fields)
+}
+
+// SetFilterExpr logs filtered entries that match 'expr' in addition to those
+// allowed by the topic filters. The expression is compiled once, an empty
+// expression removes it.
+func SetFilterExpr(expr string) error {
+	var x *filterExpr
+	if expr != "" {
+		var err error
+		if x, err = compileFilterExpr(expr); err != nil {
+			return err
+		}
+	}
+	updateOptions(func(o *options) {
+		o.filterExpr = x
+	})
+	return nil
+}
+
+// GetFilterExpr returns the filter expression, empty if none.
+func GetFilterExpr() string {
+	if x := loadOptions().filterExpr; x != nil {
+		return x.text
+	}
+	return ""
+}
+
+type andNode struct{ left, right exprNode }
+
+func (n andNode) eval(level logrus.Level, topics []string, fields logrus.Fields) bool {
+	return n.left.eval(level, topics, fields) && n.right.eval(level, topics, fields)
+}
+
+type orNode struct{ left, right exprNode }
+
+func (n orNode) eval(level logrus.Level, topics []string, fields logrus.Fields) bool {
+	return n.left.eval(level, topics, fields) || n.right.eval(level, topics, fields)
+}
+
+type notNode struct{ x exprNode }
+
+func (n notNode) eval(level logrus.Level, topics []string, fields logrus.Fields) bool {
+	return !n.x.eval(level, topics, fields)
+}
+
+type topicNode struct{ glob string }
+
+func (n topicNode) eval(_ logrus.Level, topics []string, _ logrus.Fields) bool {
+	for _, topic := range topics {
+		if ok, _ := path.Match(n.glob, topic); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// levelNode compares severity, 'level > info' matches warnings and errors
+type levelNode struct {
+	op    string
+	level logrus.Level
+}
+
+func (n levelNode) eval(level logrus.Level, _ []string, _ logrus.Fields) bool {
+	// logrus orders levels from panic (0) to trace, severity is the reverse
+	return compareOrdered(n.op, -int(level), -int(n.level))
+}
+
+type compareNode struct {
+	field string
+	op    string
+	str   string
+	num   float64
+	isNum bool
+	re    *regexp.Regexp
+}
+
+func (n compareNode) eval(_ logrus.Level, _ []string, fields logrus.Fields) bool {
+	v, ok := fields[n.field]
+	if !ok {
+		return false
+	}
+	if n.re != nil {
+		return n.re.MatchString(exprString(v))
+	}
+	if n.isNum {
+		f, ok := exprNumber(v)
+		return ok && compareOrdered(n.op, f, n.num)
+	}
+	return compareOrdered(n.op, exprString(v), n.str)
+}
+
+func compareOrdered[T int | float64 | string](op string, a, b T) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+func exprString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	case error:
+		return v.Error()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func exprNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokTopic
+	tokOp
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+type exprLexer struct {
+	src string
+	pos int
+}
+
+func (l *exprLexer) next() (token, error) {
+	for l.pos < len(l.src) && (l.src[l.pos] == ' ' || l.src[l.pos] == '\t') {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+	rest := l.src[l.pos:]
+	for _, op := range []struct {
+		text string
+		kind tokenKind
+	}{{"&&", tokAnd}, {"||", tokOr}, {"==", tokOp}, {"!=", tokOp}, {">=", tokOp}, {"<=", tokOp}, {"=~", tokOp},
+		{">", tokOp}, {"<", tokOp}, {"!", tokNot}, {"(", tokLParen}, {")", tokRParen}} {
+		if strings.HasPrefix(rest, op.text) {
+			l.pos += len(op.text)
+			return token{kind: op.kind, text: op.text, pos: start}, nil
+		}
+	}
+	c := rest[0]
+	switch {
+	case c == '"':
+		end := 1
+		for end < len(rest) && rest[end] != '"' {
+			if rest[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(rest) {
+			return token{}, fmt.Errorf("unterminated string at offset %d", start)
+		}
+		s, err := strconv.Unquote(rest[:end+1])
+		if err != nil {
+			return token{}, fmt.Errorf("invalid string at offset %d", start)
+		}
+		l.pos += end + 1
+		return token{kind: tokString, text: s, pos: start}, nil
+	case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		end := 1
+		for end < len(rest) && (rest[end] == '.' || (rest[end] >= '0' && rest[end] <= '9')) {
+			end++
+		}
+		l.pos += end
+		return token{kind: tokNumber, text: rest[:end], pos: start}, nil
+	case isIdentByte(c):
+		end := 1
+		for end < len(rest) && isIdentByte(rest[end]) {
+			end++
+		}
+		if rest[:end] == "topic" && end < len(rest) && rest[end] == ':' {
+			glob := end + 1
+			for glob < len(rest) && !strings.ContainsRune(" \t()&|!", rune(rest[glob])) {
+				glob++
+			}
+			l.pos += glob
+			return token{kind: tokTopic, text: rest[end+1 : glob], pos: start}, nil
+		}
+		l.pos += end
+		return token{kind: tokIdent, text: rest[:end], pos: start}, nil
+	}
+	return token{}, fmt.Errorf("unexpected %q at offset %d", c, start)
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+type exprParser struct {
+	lex exprLexer
+	tok token
+	err error
+}
+
+func (p *exprParser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.err = p.lex.next()
+	if p.err != nil {
+		p.tok = token{kind: tokEOF, pos: p.lex.pos}
+	}
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	return fmt.Errorf(format+" at offset %d", append(args, p.tok.pos)...)
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.tok.kind == tokOr {
+		p.next()
+		var right exprNode
+		if right, err = p.parseAnd(); err == nil {
+			left = orNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.tok.kind == tokAnd {
+		p.next()
+		var right exprNode
+		if right, err = p.parseUnary(); err == nil {
+			left = andNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	switch p.tok.kind {
+	case tokNot:
+		p.next()
+		x, err := p.parseUnary()
+		return notNode{x}, err
+	case tokLParen:
+		p.next()
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected ) but found %s", p.tok)
+		}
+		p.next()
+		return x, nil
+	case tokTopic:
+		glob := p.tok.text
+		if _, err := path.Match(glob, ""); err != nil || glob == "" {
+			return nil, p.errorf("invalid topic pattern %q", glob)
+		}
+		p.next()
+		return topicNode{glob}, nil
+	case tokIdent:
+		return p.parseComparison()
+	}
+	return nil, p.errorf("expected a comparison or topic: but found %s", p.tok)
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	field := p.tok.text
+	p.next()
+	if p.tok.kind != tokOp {
+		return nil, p.errorf("expected an operator after %q but found %s", field, p.tok)
+	}
+	op := p.tok.text
+	p.next()
+	value := p.tok
+	if value.kind != tokString && value.kind != tokNumber && value.kind != tokIdent {
+		return nil, p.errorf("expected a value after %s but found %s", op, value)
+	}
+	p.next()
+
+	if op == "=~" {
+		re, err := regexp.Compile(value.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp %q at offset %d: %w", value.text, value.pos, err)
+		}
+		if field == "level" {
+			return nil, fmt.Errorf("=~ does not apply to level at offset %d", value.pos)
+		}
+		return compareNode{field: field, op: op, re: re}, nil
+	}
+	if field == "level" {
+		level, err := logrus.ParseLevel(value.text)
+		if err != nil {
+			return nil, fmt.Errorf("unknown level %q at offset %d", value.text, value.pos)
+		}
+		return levelNode{op: op, level: level}, nil
+	}
+	n := compareNode{field: field, op: op, str: value.text}
+	if value.kind == tokNumber {
+		num, err := strconv.ParseFloat(value.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at offset %d", value.text, value.pos)
+		}
+		n.num, n.isNum = num, true
+	}
+	return n, nil
+}
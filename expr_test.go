@@ -0,0 +1,144 @@
+package logsift
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestFilterExpr_Matches(t *testing.T) {
+	fields := logrus.Fields{
+		"tenant":      "acme",
+		"duration_ms": 250,
+		"elapsed":     150 * time.Millisecond,
+		"ratio":       float32(0.5),
+		"path":        "/api/users",
+		"ok":          true,
+	}
+	topics := []string{"db.query"}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`topic:db.*`, true},
+		{`topic:auth`, false},
+		{`topic:db.* && tenant == "acme" && duration_ms > 100`, true},
+		{`topic:db.* && tenant == "acme" && duration_ms > 300`, false},
+		{`tenant != "acme" || duration_ms >= 250`, true},
+		{`!(tenant == acme)`, false},
+		{`duration_ms <= 250 && duration_ms < 251`, true},
+		{`elapsed > 100000000`, true},
+		{`ratio == 0.5`, true},
+		{`path =~ "^/api/"`, true},
+		{`path =~ "^/admin"`, false},
+		{`ok == true`, true},
+		{`missing != "x"`, false},
+		{`tenant > 5`, false},
+		{`level >= info`, true},
+		{`level > info`, false},
+		{`level == debug || level == info`, true},
+		{`(topic:auth || topic:db.query) && !(level < info)`, true},
+	}
+	for _, tt := range tests {
+		x, err := compileFilterExpr(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got := x.matches(logrus.InfoLevel, topics, fields); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.expr, tt.want, got)
+		}
+	}
+}
+
+func TestFilterExpr_CompileErrors(t *testing.T) {
+	tests := []struct {
+		expr, want string
+	}{
+		{`tenant ==`, "expected a value after == but found end of expression at offset 9"},
+		{`tenant "acme"`, `expected an operator after "tenant" but found "acme" at offset 7`},
+		{`(topic:db`, "expected ) but found end of expression"},
+		{`topic:db &&`, "expected a comparison or topic:"},
+		{`topic:[`, "invalid topic pattern"},
+		{`tenant == "acme`, "unterminated string at offset 10"},
+		{`path =~ "("`, "invalid regexp"},
+		{`level > loud`, `unknown level "loud"`},
+		{`a == 1 b == 2`, `unexpected "b" at offset 7`},
+		{`a == 1 # b`, `unexpected '#' at offset 7`},
+	}
+	for _, tt := range tests {
+		err := CompileFilterExpr(tt.expr)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.expr, tt.want, err)
+		}
+	}
+}
+
+func TestFilterExpr_EnablesFilteredEntries(t *testing.T) {
+	buf := setupTest(t)
+	if err := SetFilterExpr(`topic:db.* && tenant == "acme" && duration_ms > 100`); err != nil {
+		t.Fatal(err)
+	}
+
+	With("tenant", "acme").With("duration_ms", 250).DebugFilter("db.query", "slow")
+	With("tenant", "acme").With("duration_ms", 50).DebugFilter("db.query", "fast")
+	With("tenant", "other").With("duration_ms", 250).DebugFilter("db.query", "other tenant")
+	With("tenant", "acme").With("duration_ms", 250).DebugFilter("cache", "other topic")
+	if got := countLines(buf.String()); got != 1 || !strings.Contains(buf.String(), "slow") {
+		t.Fatalf("expected only the slow acme query, got %s", buf.String())
+	}
+
+	// the expression does not lower the level
+	buf.Reset()
+	SetLevel("info")
+	With("tenant", "acme").With("duration_ms", 250).DebugFilter("db.query", "slow")
+	if buf.Len() != 0 {
+		t.Errorf("expected debug entry to stay disabled, got %s", buf.String())
+	}
+
+	if err := SetFilterExpr(""); err != nil || GetFilterExpr() != "" {
+		t.Errorf("expected expression removed, got %q, %v", GetFilterExpr(), err)
+	}
+}
+
+func TestFilterExpr_Handler(t *testing.T) {
+	setupTest(t)
+	expr := `topic:db && duration_ms > 100`
+	req := httptest.NewRequest("GET", "/log?filterExpr="+url.QueryEscape(expr), nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if got := GetFilterExpr(); got != expr {
+		t.Fatalf("expected %q, got %q", expr, got)
+	}
+
+	req = httptest.NewRequest("GET", "/log?level=warn&filterExpr="+url.QueryEscape("duration_ms >"), nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if GetFilterExpr() != expr || GetLevel() != "debug" {
+		t.Errorf("expected invalid expression to apply nothing, got %q at %s", GetFilterExpr(), GetLevel())
+	}
+
+	req = httptest.NewRequest("GET", "/log?filterExpr=none", nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if got := GetFilterExpr(); got != "" {
+		t.Errorf("expected expression removed, got %q", got)
+	}
+}
+
+func BenchmarkFilterExpr_Matches(b *testing.B) {
+	x, err := compileFilterExpr(`topic:db.* && tenant == "acme" && duration_ms > 100`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	fields := logrus.Fields{"tenant": "acme", "duration_ms": 250}
+	topics := []string{"db.query"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !x.matches(logrus.DebugLevel, topics, fields) {
+			b.Fatal("expected a match")
+		}
+	}
+}
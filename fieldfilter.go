@@ -0,0 +1,135 @@
+package logsift
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultFieldFilterTTL is how long a field filter stays on unless set otherwise
+const DefaultFieldFilterTTL = 15 * time.Minute
+
+// FieldFilter logs every entry whose field Key equals Value, at any level and
+// regardless of its filters, until Expires.
+type FieldFilter struct {
+	Key     string    `json:"key"`
+	Value   string    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+func (f FieldFilter) String() string {
+	return f.Key + "=" + f.Value
+}
+
+func (f FieldFilter) matches(fields logrus.Fields) bool {
+	v, ok := fields[f.Key]
+	return ok && exprString(v) == f.Value
+}
+
+// AddFieldFilter turns on all levels for entries with field 'key' equal to
+// 'value', e.g. to follow one customer across all subsystems. It expires after
+// 'ttl', the field filter TTL if ttl is not positive. Adding an existing field
+// filter again renews it.
+func AddFieldFilter(key, value string, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = GetFieldFilterTTL()
+	}
+	now := time.Now()
+	f := FieldFilter{Key: key, Value: value, Expires: now.Add(ttl)}
+	updateOptions(func(o *options) {
+		o.fieldFilters = append(activeFieldFilters(o.fieldFilters, now, f), f)
+	})
+}
+
+// RemoveFieldFilter turns off the field filter for 'key' and 'value'
+func RemoveFieldFilter(key, value string) {
+	updateOptions(func(o *options) {
+		o.fieldFilters = activeFieldFilters(o.fieldFilters, time.Now(), FieldFilter{Key: key, Value: value})
+	})
+}
+
+// ResetFieldFilters turns off all field filters
+func ResetFieldFilters() {
+	updateOptions(func(o *options) {
+		o.fieldFilters = nil
+	})
+}
+
+// GetFieldFilters returns the field filters that have not expired
+func GetFieldFilters() []FieldFilter {
+	return activeFieldFilters(loadOptions().fieldFilters, time.Now(), FieldFilter{})
+}
+
+// SetFieldFilterTTL sets the TTL of field filters added without one, such as
+// those from Handler, flags and the environment.
+func SetFieldFilterTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultFieldFilterTTL
+	}
+	updateOptions(func(o *options) {
+		o.fieldFilterTTL = ttl
+	})
+}
+
+func GetFieldFilterTTL() time.Duration {
+	return loadOptions().fieldFilterTTL
+}
+
+// activeFieldFilters returns a copy of filters without the expired ones and
+// 'except'
+func activeFieldFilters(filters []FieldFilter, now time.Time, except FieldFilter) []FieldFilter {
+	var active []FieldFilter
+	for _, f := range filters {
+		if now.Before(f.Expires) && (f.Key != except.Key || f.Value != except.Value) {
+			active = append(active, f)
+		}
+	}
+	return active
+}
+
+// ParseFieldFilters parses comma-separated key=value pairs
+func ParseFieldFilters(pairs string) ([]FieldFilter, error) {
+	var filters []FieldFilter
+	for _, pair := range strings.Split(pairs, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid field filter %q, expected key=value", pair)
+		}
+		filters = append(filters, FieldFilter{Key: key, Value: value})
+	}
+	return filters, nil
+}
+
+// fieldsMatch reports whether a field filter turns on the entries of l
+func (l *logger) fieldsMatch() bool {
+	filters := loadOptions().fieldFilters
+	if len(filters) == 0 {
+		return false
+	}
+	now := time.Now()
+	for _, f := range filters {
+		if now.Before(f.Expires) && f.matches(l.entry.Data) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeBelowLevel logs an entry the logger's level would discard through a
+// copy of the logrus logger that admits every level, so hooks, redaction
+// included, and the sinks see it like any other entry. Writes to the main
+// output are serialized by the default sink.
+func writeBelowLevel(e *logrus.Entry, level logrus.Level, msg string) {
+	e.Logger = &logrus.Logger{
+		Out:          origLogger.Out,
+		Formatter:    origLogger.Formatter,
+		Hooks:        origLogger.Hooks,
+		ReportCaller: origLogger.ReportCaller,
+		Level:        logrus.TraceLevel,
+		ExitFunc:     origLogger.ExitFunc,
+		BufferPool:   origLogger.BufferPool,
+	}
+	e.Log(level, msg)
+}
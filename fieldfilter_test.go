@@ -0,0 +1,117 @@
+package logsift
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestFieldFilter_EnablesAllLevels(t *testing.T) {
+	buf := setupTest(t)
+	SetLevel("info")
+	AddFieldFilter("user_id", "42", time.Minute)
+
+	With("user_id", 42).Debug("debug for 42")
+	With("user_id", 42).InfoFilter("db", "info for 42")
+	With("user_id", 7).Debug("debug for 7")
+	DebugFilter("db", "no fields")
+	if got := countLines(buf.String()); got != 2 {
+		t.Fatalf("expected 2 lines, got %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "debug for 42") || !strings.Contains(buf.String(), "info for 42") {
+		t.Errorf("expected entries for user 42, got %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `"level":"debug"`) {
+		t.Errorf("expected entry level to be kept, got %s", buf.String())
+	}
+}
+
+func TestFieldFilter_ContextAndRedaction(t *testing.T) {
+	buf := setupTest(t)
+	SetLevel("warn")
+	AddFieldFilter("tenant", "acme", time.Minute)
+
+	ctx := NewContext(context.Background(), WithFields(map[string]interface{}{"tenant": "acme", "password": "hunter2"}))
+	FromContext(ctx).DebugFilter("cache", "miss")
+	entry := parseLogEntry(t, buf)
+	if entry["msg"] != "miss" || entry["password"] != "[REDACTED]" {
+		t.Errorf("expected redacted entry from context logger, got %v", entry)
+	}
+}
+
+func TestFieldFilter_Hooks(t *testing.T) {
+	setupTest(t)
+	SetLevel("info")
+	AddFieldFilter("user_id", "42", time.Minute)
+	hook := addTestHook(t)
+
+	WithFields(map[string]interface{}{"user_id": 42, "password": "hunter2"}).Debug("below level")
+	e := hook.LastEntry()
+	if e == nil || e.Message != "below level" || e.Level != logrus.DebugLevel {
+		t.Fatalf("expected hook to see the entry below the level, got %v", e)
+	}
+	if e.Data["password"] != "[REDACTED]" {
+		t.Errorf("expected hook to see the redacted entry, got %v", e.Data)
+	}
+}
+
+func TestFieldFilter_Expires(t *testing.T) {
+	buf := setupTest(t)
+	SetLevel("info")
+	AddFieldFilter("user_id", "42", 20*time.Millisecond)
+	if got := GetFieldFilters(); len(got) != 1 || got[0].String() != "user_id=42" {
+		t.Fatalf("expected one field filter, got %v", got)
+	}
+	time.Sleep(30 * time.Millisecond)
+	With("user_id", 42).Debug("expired")
+	if buf.Len() != 0 {
+		t.Errorf("expected expired field filter to log nothing, got %s", buf.String())
+	}
+	if got := GetFieldFilters(); len(got) != 0 {
+		t.Errorf("expected no field filters, got %v", got)
+	}
+}
+
+func TestFieldFilter_RenewAndRemove(t *testing.T) {
+	setupTest(t)
+	AddFieldFilter("user_id", "42", time.Minute)
+	AddFieldFilter("user_id", "42", time.Hour)
+	AddFieldFilter("tenant", "acme", time.Minute)
+	filters := GetFieldFilters()
+	if len(filters) != 2 || time.Until(filters[0].Expires) < 59*time.Minute {
+		t.Fatalf("expected user_id=42 to be renewed, got %v", filters)
+	}
+	RemoveFieldFilter("user_id", "42")
+	if filters := GetFieldFilters(); len(filters) != 1 || filters[0].Key != "tenant" {
+		t.Errorf("expected only tenant=acme, got %v", filters)
+	}
+}
+
+func TestFieldFilter_Handler(t *testing.T) {
+	setupTest(t)
+	req := httptest.NewRequest("GET", "/log?fieldFilter=tenant=acme,user_id=42&fieldFilterTTL=5m", nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+	filters := GetFieldFilters()
+	if len(filters) != 2 {
+		t.Fatalf("expected 2 field filters, got %v", filters)
+	}
+	if ttl := time.Until(filters[0].Expires); ttl > 5*time.Minute || ttl < 4*time.Minute {
+		t.Errorf("expected a 5m TTL, got %s", ttl)
+	}
+
+	req = httptest.NewRequest("GET", "/log?fieldFilter=tenant", nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if len(GetFieldFilters()) != 2 {
+		t.Error("expected invalid field filter to be rejected")
+	}
+
+	req = httptest.NewRequest("GET", "/log?fieldFilter=none", nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if got := GetFieldFilters(); len(got) != 0 {
+		t.Errorf("expected field filters reset, got %v", got)
+	}
+}
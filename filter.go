@@ -1,6 +1,10 @@
 package logsift
 
-import "sync"
+import (
+	"maps"
+	"sync"
+	"sync/atomic"
+)
 
 type Filter interface {
 	Add(filters ...string)
@@ -11,59 +15,133 @@ type Filter interface {
 	Allows(values ...string) bool
 }
 
+// filterMap holds the filters of a Filter. A filter mapped to false is turned
+// off explicitly, it blocks entries even when empty filters are allowed.
+type filterMap struct {
+	filters map[string]bool
+	// number of filters mapped to true
+	enabled int
+}
+
+func newFilterMap() filterMap {
+	return filterMap{filters: make(map[string]bool)}
+}
+
+func (m *filterMap) set(filter string, on bool) {
+	if filter == "" {
+		return
+	}
+	if old, ok := m.filters[filter]; ok && old {
+		m.enabled--
+	}
+	m.filters[filter] = on
+	if on {
+		m.enabled++
+	}
+}
+
+func (m *filterMap) add(filters []string) {
+	for _, filter := range filters {
+		m.set(filter, true)
+	}
+}
+
+func (m *filterMap) remove(filters []string) {
+	for _, filter := range filters {
+		if on, ok := m.filters[filter]; ok {
+			if on {
+				m.enabled--
+			}
+			delete(m.filters, filter)
+		}
+	}
+}
+
+// setMap replaces the filters with a copy of filters
+func (m *filterMap) setMap(filters map[string]bool) {
+	*m = filterMap{filters: make(map[string]bool, len(filters))}
+	for filter, on := range filters {
+		m.set(filter, on)
+	}
+}
+
+func (m *filterMap) clone() filterMap {
+	c := filterMap{filters: make(map[string]bool, len(m.filters)), enabled: m.enabled}
+	for filter, on := range m.filters {
+		c.filters[filter] = on
+	}
+	return c
+}
+
+// copy returns a copy of the filters map
+func (m *filterMap) copy() map[string]bool {
+	return maps.Clone(m.filters)
+}
+
+func (m *filterMap) allows(allowEmptyFilter bool, values []string) bool {
+	if m.enabled == 0 {
+		if !allowEmptyFilter {
+			return false
+		}
+		for _, value := range values {
+			if on, ok := m.filters[value]; ok && !on {
+				return false
+			}
+		}
+		return true
+	}
+	for _, value := range values {
+		if m.filters[value] {
+			return true
+		}
+	}
+	return false
+}
+
+// filterSnapshot is implemented by the filters of this package to report
+// their state, see GetFilters
+type filterSnapshot interface {
+	snapshot() (filters map[string]bool, allowEmptyFilter bool)
+}
+
 type concurrentMapFilter struct {
 	sync.RWMutex
 	allowEmptyFilter bool
-	filters          map[string]bool
+	filters          filterMap
 }
 
 func NewConcurrentMapFilter(allowEmptyFilter bool) Filter {
 	return &concurrentMapFilter{
 		allowEmptyFilter: allowEmptyFilter,
-		filters:          make(map[string]bool),
+		filters:          newFilterMap(),
 	}
 }
 
 func (f *concurrentMapFilter) Add(filters ...string) {
 	f.Lock()
 	defer f.Unlock()
-	for _, filter := range filters {
-		if filter != "" {
-			f.filters[filter] = true
-		}
-	}
+	f.filters.add(filters)
 }
 
 func (f *concurrentMapFilter) Remove(filters ...string) {
 	f.Lock()
 	defer f.Unlock()
-	for _, filter := range filters {
-		if filter != "" {
-			delete(f.filters, filter)
-		}
-	}
+	f.filters.remove(filters)
 }
 
 func (f *concurrentMapFilter) Set(filters ...string) {
 	f.Lock()
 	defer f.Unlock()
-	f.filters = make(map[string]bool)
-	for _, filter := range filters {
-		if filter != "" {
-			f.filters[filter] = true
-		}
-	}
+	f.filters = newFilterMap()
+	f.filters.add(filters)
 }
 
+// SetMap replaces the filters with a copy of 'filters', filters mapped to
+// false are turned off
 func (f *concurrentMapFilter) SetMap(filters map[string]bool) {
 	f.Lock()
 	defer f.Unlock()
-	f.filters = filters
-	for filter := range f.filters {
-		if filter == "" {
-			delete(f.filters, filter)
-		}
-	}
+	f.filters.setMap(filters)
 }
 
 func (f *concurrentMapFilter) SetAllowEmptyFilter(allowEmpty bool) {
@@ -75,61 +153,44 @@ func (f *concurrentMapFilter) SetAllowEmptyFilter(allowEmpty bool) {
 func (f *concurrentMapFilter) Allows(values ...string) bool {
 	f.RLock()
 	defer f.RUnlock()
-	if f.filters == nil || len(f.filters) == 0 {
-		return f.allowEmptyFilter
-	}
-	for _, value := range values {
-		if _, ok := f.filters[value]; ok {
-			return true
-		}
-	}
-	return false
+	return f.filters.allows(f.allowEmptyFilter, values)
+}
+
+func (f *concurrentMapFilter) snapshot() (map[string]bool, bool) {
+	f.RLock()
+	defer f.RUnlock()
+	return f.filters.copy(), f.allowEmptyFilter
 }
 
 type unsafeMapFilter struct {
 	allowEmptyFilter bool
-	filters          map[string]bool
+	filters          filterMap
 }
 
 func NewUnsafeMapFilter(allowEmptyFilter bool) Filter {
 	return &unsafeMapFilter{
 		allowEmptyFilter: allowEmptyFilter,
-		filters:          make(map[string]bool),
+		filters:          newFilterMap(),
 	}
 }
 
 func (f *unsafeMapFilter) Add(filters ...string) {
-	for _, filter := range filters {
-		if filter != "" {
-			f.filters[filter] = true
-		}
-	}
+	f.filters.add(filters)
 }
 
 func (f *unsafeMapFilter) Remove(filters ...string) {
-	for _, filter := range filters {
-		if filter != "" {
-			delete(f.filters, filter)
-		}
-	}
+	f.filters.remove(filters)
 }
 
 func (f *unsafeMapFilter) Set(filters ...string) {
-	f.filters = make(map[string]bool)
-	for _, filter := range filters {
-		if filter != "" {
-			f.filters[filter] = true
-		}
-	}
+	f.filters = newFilterMap()
+	f.filters.add(filters)
 }
 
+// SetMap replaces the filters with a copy of 'filters', filters mapped to
+// false are turned off
 func (f *unsafeMapFilter) SetMap(filters map[string]bool) {
-	f.filters = filters
-	for filter := range f.filters {
-		if filter == "" {
-			delete(f.filters, filter)
-		}
-	}
+	f.filters.setMap(filters)
 }
 
 func (f *unsafeMapFilter) SetAllowEmptyFilter(allowEmpty bool) {
@@ -137,13 +198,81 @@ func (f *unsafeMapFilter) SetAllowEmptyFilter(allowEmpty bool) {
 }
 
 func (f *unsafeMapFilter) Allows(values ...string) bool {
-	if f.filters == nil || len(f.filters) == 0 {
-		return f.allowEmptyFilter
-	}
-	for _, value := range values {
-		if _, ok := f.filters[value]; ok {
-			return true
-		}
-	}
-	return false
+	return f.filters.allows(f.allowEmptyFilter, values)
+}
+
+func (f *unsafeMapFilter) snapshot() (map[string]bool, bool) {
+	return f.filters.copy(), f.allowEmptyFilter
+}
+
+// filterSet is the immutable state published by atomicFilter
+type filterSet struct {
+	allowEmptyFilter bool
+	filters          filterMap
+}
+
+// atomicFilter publishes an immutable filterSet, so Allows never blocks and
+// writers copy the set under a mutex.
+type atomicFilter struct {
+	mu  sync.Mutex
+	set atomic.Pointer[filterSet]
+}
+
+func NewAtomicFilter(allowEmptyFilter bool) Filter {
+	f := &atomicFilter{}
+	f.set.Store(&filterSet{allowEmptyFilter: allowEmptyFilter, filters: newFilterMap()})
+	return f
+}
+
+// update applies fn to a copy of the filter set and publishes it
+func (f *atomicFilter) update(fn func(s *filterSet)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	old := f.set.Load()
+	s := &filterSet{allowEmptyFilter: old.allowEmptyFilter, filters: old.filters.clone()}
+	fn(s)
+	f.set.Store(s)
+}
+
+func (f *atomicFilter) Add(filters ...string) {
+	f.update(func(s *filterSet) {
+		s.filters.add(filters)
+	})
+}
+
+func (f *atomicFilter) Remove(filters ...string) {
+	f.update(func(s *filterSet) {
+		s.filters.remove(filters)
+	})
+}
+
+func (f *atomicFilter) Set(filters ...string) {
+	f.update(func(s *filterSet) {
+		s.filters = newFilterMap()
+		s.filters.add(filters)
+	})
+}
+
+// SetMap replaces the filters with a copy of 'filters', filters mapped to
+// false are turned off
+func (f *atomicFilter) SetMap(filters map[string]bool) {
+	f.update(func(s *filterSet) {
+		s.filters.setMap(filters)
+	})
+}
+
+func (f *atomicFilter) SetAllowEmptyFilter(allowEmpty bool) {
+	f.update(func(s *filterSet) {
+		s.allowEmptyFilter = allowEmpty
+	})
+}
+
+func (f *atomicFilter) Allows(values ...string) bool {
+	s := f.set.Load()
+	return s.filters.allows(s.allowEmptyFilter, values)
+}
+
+func (f *atomicFilter) snapshot() (map[string]bool, bool) {
+	s := f.set.Load()
+	return s.filters.copy(), s.allowEmptyFilter
 }
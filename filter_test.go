@@ -6,12 +6,13 @@ import (
 	"testing"
 )
 
-// filterFactories returns constructors for both Filter implementations
-// so every test runs against both with zero duplication.
+// filterFactories returns constructors for all Filter implementations
+// so every test runs against all three with zero duplication.
 func filterFactories() map[string]func(bool) Filter {
 	return map[string]func(bool) Filter{
 		"ConcurrentMapFilter": func(allow bool) Filter { return NewConcurrentMapFilter(allow) },
 		"UnsafeMapFilter":     func(allow bool) Filter { return NewUnsafeMapFilter(allow) },
+		"AtomicFilter":        func(allow bool) Filter { return NewAtomicFilter(allow) },
 	}
 }
 
@@ -106,6 +107,75 @@ func TestFilter_SetMap(t *testing.T) {
 	}
 }
 
+func TestFilter_SetMap_DoesNotAliasCallerMap(t *testing.T) {
+	for name, factory := range filterFactories() {
+		t.Run(name, func(t *testing.T) {
+			f := factory(false)
+			filters := map[string]bool{"auth": true, "": true}
+			f.SetMap(filters)
+
+			if _, ok := filters[""]; !ok {
+				t.Error("expected SetMap to leave the caller's map unchanged")
+			}
+			filters["db"] = true
+			delete(filters, "auth")
+			if f.Allows("db") {
+				t.Error("expected later writes to the caller's map to be ignored")
+			}
+			if !f.Allows("auth") {
+				t.Error("expected 'auth' to stay after the caller deleted it")
+			}
+		})
+	}
+}
+
+func TestFilter_SetMap_HonorsFalse(t *testing.T) {
+	for name, factory := range filterFactories() {
+		t.Run(name, func(t *testing.T) {
+			f := factory(false)
+			f.SetMap(map[string]bool{"auth": true, "db": false})
+
+			if !f.Allows("auth") {
+				t.Error("expected 'auth' to be enabled")
+			}
+			if f.Allows("db") {
+				t.Error("expected 'db' mapped to false to be disabled")
+			}
+
+			f.SetMap(map[string]bool{"db": false})
+			if f.Allows("db") {
+				t.Error("expected a map of only false values to enable nothing")
+			}
+
+			f.Add("db")
+			if !f.Allows("db") {
+				t.Error("expected Add to turn 'db' on")
+			}
+		})
+	}
+}
+
+func TestFilter_False_OverridesAllowEmpty(t *testing.T) {
+	for name, factory := range filterFactories() {
+		t.Run(name, func(t *testing.T) {
+			f := factory(true)
+			f.SetMap(map[string]bool{"db": false})
+
+			if f.Allows("db") {
+				t.Error("expected 'db' to be off although empty filters are allowed")
+			}
+			if !f.Allows("auth") {
+				t.Error("expected other filters to pass with no filter enabled")
+			}
+
+			f.Remove("db")
+			if !f.Allows("db") {
+				t.Error("expected 'db' to pass once its false entry is removed")
+			}
+		})
+	}
+}
+
 func TestFilter_Allows_EmptyFilter_AllowTrue(t *testing.T) {
 	for name, factory := range filterFactories() {
 		t.Run(name, func(t *testing.T) {
@@ -181,7 +251,14 @@ func TestFilter_Allows_NoArgs(t *testing.T) {
 }
 
 func TestConcurrentMapFilter_ThreadSafety(t *testing.T) {
-	f := NewConcurrentMapFilter(false)
+	testFilterThreadSafety(t, NewConcurrentMapFilter(false))
+}
+
+func TestAtomicFilter_ThreadSafety(t *testing.T) {
+	testFilterThreadSafety(t, NewAtomicFilter(false))
+}
+
+func testFilterThreadSafety(t *testing.T, f Filter) {
 	var wg sync.WaitGroup
 	const goroutines = 50
 	const ops = 200
@@ -203,3 +280,54 @@ func TestConcurrentMapFilter_ThreadSafety(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+// hit and miss are checked once per op, preallocated so the variadic calls
+// do not allocate
+var (
+	benchHit  = []string{"db"}
+	benchMiss = []string{"http", "grpc"}
+)
+
+func benchmarkFilterAllows(b *testing.B, f Filter) {
+	f.Set("auth", "db", "cache", "queue")
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			f.Allows(benchHit...)
+			f.Allows(benchMiss...)
+		}
+	})
+}
+
+func BenchmarkFilter_Allows(b *testing.B) {
+	for name, factory := range filterFactories() {
+		b.Run(name, func(b *testing.B) {
+			benchmarkFilterAllows(b, factory(false))
+		})
+	}
+}
+
+// the unsafe filter is left out, it does not support concurrent writes
+func BenchmarkFilter_AllowsWithWrites(b *testing.B) {
+	for name, factory := range map[string]func(bool) Filter{
+		"ConcurrentMapFilter": func(allow bool) Filter { return NewConcurrentMapFilter(allow) },
+		"AtomicFilter":        func(allow bool) Filter { return NewAtomicFilter(allow) },
+	} {
+		b.Run(name, func(b *testing.B) {
+			f := factory(false)
+			f.Set("auth", "db", "cache", "queue")
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if i%1000 == 0 {
+						f.Add("db")
+					}
+					f.Allows(benchHit...)
+					f.Allows(benchMiss...)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package logsift
+
+import (
+	"flag"
+	"os"
+	"strings"
+)
+
+// ConfigureFromEnv applies settings from environment variables named after
+// their flags with 'prefix', such as APP_LOG_LEVEL, APP_LOG_FORMAT and
+// APP_LOG_FILTERS for prefix "APP_". All variables are validated first,
+// nothing is applied if one of them is invalid.
+func ConfigureFromEnv(prefix string) error {
+	changes, err := parseSettings(func(name string) string {
+		if s := lookupSetting(name); s != nil && s.flag != "" {
+			return os.Getenv(envName(prefix, s.flag))
+		}
+		return ""
+	})
+	if err != nil {
+		return err
+	}
+	return changes.set()
+}
+
+// envName turns a flag name such as log-level into PREFIX_LOG_LEVEL
+func envName(prefix, flag string) string {
+	return prefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+func lookupSetting(name string) *setting {
+	for i := range settings {
+		if settings[i].name == name {
+			return &settings[i]
+		}
+	}
+	return nil
+}
+
+// RegisterFlags adds a flag per setting to fs, such as -log-level, -log-format
+// and -log-filters. Values are validated and applied as the flags are parsed.
+// For pflag, register on a flag.FlagSet and add it via AddGoFlagSet.
+func RegisterFlags(fs *flag.FlagSet) {
+	for i := range settings {
+		if s := &settings[i]; s.flag != "" {
+			fs.Var(&settingFlag{setting: s}, s.flag, s.usage)
+		}
+	}
+}
+
+// settingFlag is a flag.Value setting a setting
+type settingFlag struct {
+	setting *setting
+	value   string
+}
+
+func (f *settingFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *settingFlag) Set(value string) error {
+	apply, err := f.setting.parse(value)
+	if err != nil {
+		return err
+	}
+	if err := apply(); err != nil {
+		return err
+	}
+	f.value = value
+	return nil
+}
+
+// Type names the value type for pflag's usage output
+func (f *settingFlag) Type() string {
+	if f.setting.boolean {
+		return "bool"
+	}
+	return "string"
+}
+
+func (f *settingFlag) IsBoolFlag() bool {
+	return f.setting.boolean
+}
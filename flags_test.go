@@ -0,0 +1,85 @@
+package logsift
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestConfigureFromEnv(t *testing.T) {
+	setupTest(t)
+	t.Setenv("APP_LOG_LEVEL", "warn")
+	t.Setenv("APP_LOG_FORMAT", "nocolor")
+	t.Setenv("APP_LOG_FILTERS", "db,auth")
+	t.Setenv("APP_LOG_SOURCE_STRUCTURED", "true")
+	t.Setenv("LOG_LEVEL", "error")
+
+	if err := ConfigureFromEnv("APP_"); err != nil {
+		t.Fatal(err)
+	}
+	if GetLevel() != "warning" || GetFormat() != "nocolor" {
+		t.Errorf("unexpected level %q and format %q", GetLevel(), GetFormat())
+	}
+	if !Default().FiltersAllow("db") || !Default().FiltersAllow("auth") {
+		t.Error("expected filters from the environment")
+	}
+	if !loadOptions().sourceStructured {
+		t.Error("expected structured source")
+	}
+}
+
+func TestConfigureFromEnv_Invalid(t *testing.T) {
+	setupTest(t)
+	t.Setenv("APP_LOG_FORMAT", "nocolor")
+	t.Setenv("APP_LOG_LEVEL", "verbose")
+
+	err := ConfigureFromEnv("APP_")
+	if err == nil || !strings.Contains(err.Error(), "level") {
+		t.Fatalf("expected level error, got %v", err)
+	}
+	if GetLevel() != "debug" || GetFormat() != "json" {
+		t.Errorf("expected nothing applied, got level %q and format %q", GetLevel(), GetFormat())
+	}
+}
+
+func TestRegisterFlags(t *testing.T) {
+	setupTest(t)
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	RegisterFlags(fs)
+
+	err := fs.Parse([]string{"-log-level", "error", "-log-filters=db", "-log-allow-empty-filter", "-log-dedup", "1s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if GetLevel() != "error" {
+		t.Errorf("expected level 'error', got %q", GetLevel())
+	}
+	if !Default().FiltersAllow("db") {
+		t.Error("expected 'db' filter")
+	}
+	if GetDedup().String() != "1s" {
+		t.Errorf("expected dedup 1s, got %s", GetDedup())
+	}
+	if got := fs.Lookup("log-level").Value.String(); got != "error" {
+		t.Errorf("expected flag value 'error', got %q", got)
+	}
+	if fs.Lookup("resetFilter") != nil || fs.Lookup("log-reset-filter") != nil {
+		t.Error("expected resetFilter to have no flag")
+	}
+}
+
+func TestRegisterFlags_Invalid(t *testing.T) {
+	setupTest(t)
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	RegisterFlags(fs)
+
+	err := fs.Parse([]string{"-log-level", "verbose"})
+	if err == nil || !strings.Contains(err.Error(), "log-level") {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if GetLevel() != "debug" {
+		t.Errorf("expected level to stay 'debug', got %q", GetLevel())
+	}
+}
@@ -0,0 +1,135 @@
+package logsift
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// presets are the structured json formats selectable through SetFormat.
+var presets = map[string]*presetFormatter{
+	// Elastic Common Schema
+	"ecs": {
+		name:     "ecs",
+		timeKey:  "@timestamp",
+		levelKey: "log.level",
+		msgKey:   "message",
+		level:    logrus.Level.String,
+		extra:    map[string]interface{}{"ecs.version": "1.6.0"},
+		source: func(data logrus.Fields, s Source) {
+			data["log.origin.file.name"] = s.File
+			data["log.origin.file.line"] = s.Line
+			if s.Function != "" {
+				data["log.origin.function"] = s.Function
+			}
+		},
+	},
+	// Google Cloud Logging structured payload
+	"gcp": {
+		name:     "gcp",
+		timeKey:  "time",
+		levelKey: "severity",
+		msgKey:   "message",
+		level:    gcpSeverity,
+		source: func(data logrus.Fields, s Source) {
+			data["logging.googleapis.com/sourceLocation"] = map[string]interface{}{
+				"file":     s.File,
+				"line":     s.Line,
+				"function": s.Function,
+			}
+		},
+	},
+	// Datadog reserved and standard attributes
+	"datadog": {
+		name:     "datadog",
+		timeKey:  "date",
+		levelKey: "status",
+		msgKey:   "message",
+		level:    logrus.Level.String,
+		source: func(data logrus.Fields, s Source) {
+			data["logger"] = map[string]interface{}{
+				"file_name":   s.File,
+				"line":        s.Line,
+				"method_name": s.Function,
+			}
+		},
+	},
+}
+
+// presetFormatter renders entries as a single json object whose reserved keys
+// follow the schema of a log product. Fields are written at the top level,
+// prefixed with "fields." if they clash with a reserved key.
+type presetFormatter struct {
+	name     string
+	timeKey  string
+	levelKey string
+	msgKey   string
+	level    func(logrus.Level) string
+	source   func(logrus.Fields, Source)
+	extra    map[string]interface{}
+}
+
+func (f *presetFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := make(logrus.Fields, len(entry.Data)+len(f.extra)+3)
+	var src *Source
+	for k, v := range entry.Data {
+		if s, ok := v.(Source); ok && k == "source" {
+			src = &s
+			continue
+		}
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		data[k] = v
+	}
+
+	reserved := make(logrus.Fields, len(f.extra)+6)
+	reserved[f.timeKey] = entry.Time.Format(time.RFC3339Nano)
+	reserved[f.levelKey] = f.level(entry.Level)
+	reserved[f.msgKey] = entry.Message
+	for k, v := range f.extra {
+		reserved[k] = v
+	}
+	if src != nil {
+		f.source(reserved, *src)
+	}
+	for k, v := range reserved {
+		if clash, ok := data[k]; ok {
+			data["fields."+k] = clash
+		}
+		data[k] = v
+	}
+
+	b := entry.Buffer
+	if b == nil {
+		b = &bytes.Buffer{}
+	}
+	if err := json.NewEncoder(b).Encode(data); err != nil {
+		return nil, fmt.Errorf("failed to marshal fields to JSON, %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// gcpSeverity maps logrus levels onto the LogSeverity enum of Cloud Logging.
+func gcpSeverity(level logrus.Level) string {
+	switch level {
+	case logrus.TraceLevel, logrus.DebugLevel:
+		return "DEBUG"
+	case logrus.InfoLevel:
+		return "INFO"
+	case logrus.WarnLevel:
+		return "WARNING"
+	case logrus.ErrorLevel:
+		return "ERROR"
+	case logrus.FatalLevel:
+		return "CRITICAL"
+	case logrus.PanicLevel:
+		return "ALERT"
+	default:
+		return strings.ToUpper(level.String())
+	}
+}
@@ -0,0 +1,113 @@
+package logsift
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetFormat_Presets(t *testing.T) {
+	for _, format := range []string{"ecs", "gcp", "datadog"} {
+		t.Run(format, func(t *testing.T) {
+			setupTest(t)
+			SetFormat(format)
+			if got := GetFormat(); got != format {
+				t.Errorf("expected %q, got %q", format, got)
+			}
+		})
+	}
+}
+
+func TestFormat_ECS(t *testing.T) {
+	buf := setupTest(t)
+	SetFormat("ecs")
+
+	With("user", "alice").Warn("ecs message")
+
+	entry := parseLogEntry(t, buf)
+	if entry["message"] != "ecs message" {
+		t.Errorf("expected message='ecs message', got %v", entry["message"])
+	}
+	if entry["log.level"] != "warning" {
+		t.Errorf("expected log.level='warning', got %v", entry["log.level"])
+	}
+	if _, ok := entry["@timestamp"]; !ok {
+		t.Error("expected '@timestamp' field")
+	}
+	if entry["log.origin.file.name"] != "format_test.go" {
+		t.Errorf("expected log.origin.file.name='format_test.go', got %v", entry["log.origin.file.name"])
+	}
+	if _, ok := entry["log.origin.file.line"].(float64); !ok {
+		t.Errorf("expected numeric log.origin.file.line, got %v", entry["log.origin.file.line"])
+	}
+	if fn, _ := entry["log.origin.function"].(string); !strings.HasSuffix(fn, "TestFormat_ECS") {
+		t.Errorf("expected log.origin.function to name the test, got %v", entry["log.origin.function"])
+	}
+	if entry["user"] != "alice" {
+		t.Errorf("expected user='alice', got %v", entry["user"])
+	}
+	if _, ok := entry["source"]; ok {
+		t.Error("expected padded 'source' string to be replaced by structured origin")
+	}
+}
+
+func TestFormat_GCP(t *testing.T) {
+	buf := setupTest(t)
+	SetFormat("gcp")
+
+	Error("gcp message")
+
+	entry := parseLogEntry(t, buf)
+	if entry["severity"] != "ERROR" {
+		t.Errorf("expected severity='ERROR', got %v", entry["severity"])
+	}
+	if entry["message"] != "gcp message" {
+		t.Errorf("expected message='gcp message', got %v", entry["message"])
+	}
+	loc, ok := entry["logging.googleapis.com/sourceLocation"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected sourceLocation object, got %v", entry["logging.googleapis.com/sourceLocation"])
+	}
+	if loc["file"] != "format_test.go" {
+		t.Errorf("expected sourceLocation.file='format_test.go', got %v", loc["file"])
+	}
+	if fn, _ := loc["function"].(string); !strings.HasSuffix(fn, "TestFormat_GCP") {
+		t.Errorf("expected sourceLocation.function to name the test, got %v", loc["function"])
+	}
+}
+
+func TestFormat_Datadog(t *testing.T) {
+	buf := setupTest(t)
+	SetFormat("datadog")
+
+	Info("dd message")
+
+	entry := parseLogEntry(t, buf)
+	if entry["status"] != "info" {
+		t.Errorf("expected status='info', got %v", entry["status"])
+	}
+	if _, ok := entry["date"]; !ok {
+		t.Error("expected 'date' field")
+	}
+	logger, ok := entry["logger"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected logger object, got %v", entry["logger"])
+	}
+	if logger["file_name"] != "format_test.go" {
+		t.Errorf("expected logger.file_name='format_test.go', got %v", logger["file_name"])
+	}
+}
+
+func TestFormat_PresetFieldClash(t *testing.T) {
+	buf := setupTest(t)
+	SetFormat("gcp")
+
+	With("severity", "custom").Info("clash")
+
+	entry := parseLogEntry(t, buf)
+	if entry["severity"] != "INFO" {
+		t.Errorf("expected reserved severity='INFO', got %v", entry["severity"])
+	}
+	if entry["fields.severity"] != "custom" {
+		t.Errorf("expected clashing field under 'fields.severity', got %v", entry["fields.severity"])
+	}
+}
@@ -0,0 +1,163 @@
+package logsift
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// levelDirectives sets the level by the caller's package, parsed from a
+// string such as
+//
+//	info,github.com/acme/payments=debug,github.com/acme/db/*=trace
+//
+// A pattern is a path.Match glob on the import path, a trailing "/*" also
+// matches the package itself and all packages below it. The longest matching
+// pattern wins. A bare level applies to packages without a directive, the
+// logger's level if there is none.
+type levelDirectives struct {
+	text       string
+	gen        uint64
+	directives []levelDirective
+	fallback   logrus.Level
+	hasDefault bool
+	// most and least verbose level of the directives and the fallback, an
+	// entry outside them is decided without resolving its callsite
+	verbose, quiet logrus.Level
+}
+
+type levelDirective struct {
+	pattern string
+	level   logrus.Level
+}
+
+// levelDirectivesGen numbers directive sets, so callsites can tell a cached
+// decision is stale
+var levelDirectivesGen atomic.Uint64
+
+func parseLevelDirectives(text string) (*levelDirectives, error) {
+	d := &levelDirectives{text: text, gen: levelDirectivesGen.Add(1), quiet: logrus.TraceLevel}
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		pattern, value, ok := strings.Cut(part, "=")
+		if !ok {
+			pattern, value = "", part
+		}
+		level, err := logrus.ParseLevel(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid level directive %q: %w", part, err)
+		}
+		d.verbose = max(d.verbose, level)
+		d.quiet = min(d.quiet, level)
+		if pattern == "" {
+			if d.hasDefault {
+				return nil, fmt.Errorf("invalid level directive %q: more than one default level", part)
+			}
+			d.fallback, d.hasDefault = level, true
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid level directive %q: %w", part, err)
+		}
+		d.directives = append(d.directives, levelDirective{pattern: pattern, level: level})
+	}
+	sort.SliceStable(d.directives, func(i, j int) bool {
+		return len(d.directives[i].pattern) > len(d.directives[j].pattern)
+	})
+	return d, nil
+}
+
+func (d levelDirective) matches(pkg string) bool {
+	if ok, _ := path.Match(d.pattern, pkg); ok {
+		return true
+	}
+	if parent, ok := strings.CutSuffix(d.pattern, "/*"); ok {
+		return pkg == parent || strings.HasPrefix(pkg, parent+"/")
+	}
+	return false
+}
+
+// matchedLevel is the level set for packages matching a directive, kept in
+// the callsite as gen<<16 | matchedLevel | level
+const matchedLevel = 1 << 8
+
+// siteLevel returns the level in effect at cs, 'level' being the logger's
+func (d *levelDirectives) siteLevel(cs *callsite, level logrus.Level) logrus.Level {
+	if cs != nil {
+		c := cs.levelCache.Load()
+		if c>>16 != d.gen {
+			c = d.gen << 16
+			for _, dir := range d.directives {
+				if dir.matches(cs.pkg) {
+					c |= matchedLevel | uint64(dir.level)
+					break
+				}
+			}
+			cs.levelCache.Store(c)
+		}
+		if c&matchedLevel != 0 {
+			return logrus.Level(c & 0xff)
+		}
+	}
+	if d.hasDefault {
+		return d.fallback
+	}
+	return level
+}
+
+// levelEnabled reports whether 'level' is enabled for the caller of the
+// logging method, see SetLevelDirectives
+func (l *logger) levelEnabled(level logrus.Level) bool {
+	d := loadOptions().levels
+	if d == nil {
+		return l.IsLevelEnabled(level)
+	}
+	current := l.Logger.GetLevel()
+	fallback := current
+	if d.hasDefault {
+		fallback = d.fallback
+	}
+	// no directive can change the decision, skip the stack walk
+	if level > d.verbose && level > fallback {
+		return false
+	}
+	if level <= d.quiet && level <= fallback {
+		return true
+	}
+	// Callers, callerSite, levelEnabled, enabled, log and the logging method
+	return level <= d.siteLevel(callerSite(l.skip+1), current)
+}
+
+// SetLevelDirectives sets the level by the caller's package with directives
+// such as "info,github.com/acme/payments=debug,github.com/acme/db/*=trace".
+// The decision is cached per call site. Entries below the logger's level go
+// through redaction and the sinks, other hooks do not see them. An empty
+// string removes the directives.
+func SetLevelDirectives(directives string) error {
+	var d *levelDirectives
+	if directives != "" {
+		var err error
+		if d, err = parseLevelDirectives(directives); err != nil {
+			return err
+		}
+	}
+	updateOptions(func(o *options) {
+		o.levels = d
+	})
+	return nil
+}
+
+// GetLevelDirectives returns the level directives, empty if none
+func GetLevelDirectives() string {
+	if d := loadOptions().levels; d != nil {
+		return d.text
+	}
+	return ""
+}
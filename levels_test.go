@@ -0,0 +1,164 @@
+package logsift
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+const testPackage = "github.com/jenish-rudani/logsift"
+
+func TestLevelDirectives_Match(t *testing.T) {
+	d, err := parseLevelDirectives("info, github.com/acme/payments=debug,github.com/acme/db/*=trace,github.com/acme/db/slow=error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		pkg  string
+		want logrus.Level
+	}{
+		{"github.com/acme/payments", logrus.DebugLevel},
+		{"github.com/acme/payments/stripe", logrus.InfoLevel},
+		{"github.com/acme/db", logrus.TraceLevel},
+		{"github.com/acme/db/pool", logrus.TraceLevel},
+		{"github.com/acme/db/pool/conn", logrus.TraceLevel},
+		{"github.com/acme/db/slow", logrus.ErrorLevel},
+		{"github.com/acme/dbx", logrus.InfoLevel},
+		{"main", logrus.InfoLevel},
+	}
+	for _, tt := range tests {
+		if got := d.siteLevel(&callsite{pkg: tt.pkg}, logrus.WarnLevel); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.pkg, tt.want, got)
+		}
+	}
+	if d.verbose != logrus.TraceLevel || d.quiet != logrus.ErrorLevel {
+		t.Errorf("expected levels from trace to error, got %s to %s", d.verbose, d.quiet)
+	}
+}
+
+func TestLevelDirectives_Invalid(t *testing.T) {
+	for _, directives := range []string{"verbose", "info,debug", "github.com/acme=loud", "github.com/[=debug"} {
+		if err := SetLevelDirectives(directives); err == nil {
+			t.Errorf("%s: expected error", directives)
+		}
+	}
+}
+
+func TestLevelDirectives_EnablePackage(t *testing.T) {
+	buf := setupTest(t)
+	SetLevel("info")
+	if err := SetLevelDirectives("github.com/acme/*=trace," + testPackage + "=debug"); err != nil {
+		t.Fatal(err)
+	}
+
+	Debug("package debug")
+	DebugFilter("db", "filtered")
+	if got := countLines(buf.String()); got != 1 {
+		t.Fatalf("expected only the debug entry, got %s", buf.String())
+	}
+	entry := parseLogEntry(t, buf)
+	if entry["msg"] != "package debug" || !strings.HasPrefix(entry["source"].(string), " levels_test.go:") {
+		t.Errorf("unexpected entry %v", entry)
+	}
+}
+
+func TestLevelDirectives_QuietPackage(t *testing.T) {
+	buf := setupTest(t)
+	if err := SetLevelDirectives("github.com/jenish-rudani/*=warn"); err != nil {
+		t.Fatal(err)
+	}
+	Info("quiet")
+	Warn("loud")
+	if got := countLines(buf.String()); got != 1 || !strings.Contains(buf.String(), "loud") {
+		t.Errorf("expected only the warning, got %s", buf.String())
+	}
+
+	// a default level applies to packages without a directive
+	buf.Reset()
+	if err := SetLevelDirectives("error,github.com/acme/payments=debug"); err != nil {
+		t.Fatal(err)
+	}
+	Warn("below default")
+	if buf.Len() != 0 {
+		t.Errorf("expected default level error, got %s", buf.String())
+	}
+}
+
+func TestLevelDirectives_CacheFollowsChanges(t *testing.T) {
+	buf := setupTest(t)
+	SetLevel("info")
+	for i, directives := range []string{testPackage + "=debug", testPackage + "=info", "", testPackage + "=debug"} {
+		if err := SetLevelDirectives(directives); err != nil {
+			t.Fatal(err)
+		}
+		buf.Reset()
+		Debug("same call site")
+		if logged, want := buf.Len() > 0, i%3 == 0; logged != want {
+			t.Errorf("%q: expected logged %v, got %v", directives, want, logged)
+		}
+	}
+}
+
+func TestLevelDirectives_Handler(t *testing.T) {
+	setupTest(t)
+	req := httptest.NewRequest("GET", "/log?levels=info,"+testPackage+"=trace", nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if got := GetLevelDirectives(); got != "info,"+testPackage+"=trace" {
+		t.Fatalf("unexpected directives %q", got)
+	}
+
+	req = httptest.NewRequest("GET", "/log?levels=info,debug", nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if got := GetLevelDirectives(); got != "info,"+testPackage+"=trace" {
+		t.Errorf("expected invalid directives to be rejected, got %q", got)
+	}
+
+	req = httptest.NewRequest("GET", "/log?levels=none", nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if got := GetLevelDirectives(); got != "" {
+		t.Errorf("expected directives removed, got %q", got)
+	}
+}
+
+func BenchmarkLevelDirectives(b *testing.B) {
+	SetOutput(io.Discard)
+	SetLevel("info")
+	defer SetLevel("debug")
+	for _, bm := range []struct{ name, directives string }{
+		{"None", ""},
+		{"OtherPackage", "github.com/acme/payments=debug"},
+		{"Disabled", testPackage + "=info,github.com/acme/payments=debug"},
+		{"BelowAll", "github.com/acme/payments=info"},
+	} {
+		if err := SetLevelDirectives(bm.directives); err != nil {
+			b.Fatal(err)
+		}
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				Debug("disabled")
+			}
+		})
+	}
+	SetLevelDirectives("")
+}
+
+// BenchmarkLevelEnabled measures entries no directive can change, decided
+// without resolving the callsite
+func BenchmarkLevelEnabled(b *testing.B) {
+	SetLevel("info")
+	defer SetLevel("debug")
+	if err := SetLevelDirectives("github.com/acme/payments=debug,github.com/acme/db=warn"); err != nil {
+		b.Fatal(err)
+	}
+	defer SetLevelDirectives("")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if defaultLogger.levelEnabled(logrus.TraceLevel) || !defaultLogger.levelEnabled(logrus.ErrorLevel) {
+			b.Fatal("expected trace disabled and error enabled")
+		}
+	}
+}
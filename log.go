@@ -6,9 +6,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"runtime"
-	"strconv"
+	"path"
 	"strings"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -22,8 +22,7 @@ var (
 	defaultLogger = &logger{
 		Logger:    origLogger,
 		entry:     logrus.NewEntry(origLogger),
-		fmt:       "short",
-		logFilter: NewConcurrentMapFilter(false),
+		logFilter: NewAtomicFilter(false),
 	}
 
 	ErrorCounter = promauto.NewCounterVec(prometheus.CounterOpts{
@@ -35,116 +34,95 @@ var (
 type logger struct {
 	*logrus.Logger
 	entry     *logrus.Entry
-	fmt       string
 	logFilter Filter
+	// extra frames to skip above the caller, see WithCallerSkip
+	skip int
+	// keeps entries that are not logged until an error, see WithFlightRecorder
+	recorder *FlightRecorder
 }
 
 func (l *logger) Debug(args ...interface{}) {
-	l.withSource().Debug(args...)
+	l.log(logrus.DebugLevel, nil, args...)
 }
 
 func (l *logger) Debugln(args ...interface{}) {
-	l.withSource().Debugln(args...)
+	l.logln(logrus.DebugLevel, nil, args...)
 }
 
 func (l *logger) Debugf(msg string, args ...interface{}) {
-	l.withSource().Debugf(msg, args...)
+	l.logf(logrus.DebugLevel, nil, msg, args...)
 }
 
 // DebugFilter will log debug only if 'filter' was previously added via UpdateFilter of AddFilter
 func (l *logger) DebugFilter(filter string, args ...interface{}) {
-	if l.FiltersAllow(filter) {
-		l.withSource().Debug(args...)
-	}
+	l.log(logrus.DebugLevel, []string{filter}, args...)
 }
 
 // DebugFilterLn will log debug only if 'filter' was previously added via UpdateFilter of AddFilter
 func (l *logger) DebugFilterLn(filter string, args ...interface{}) {
-	if l.FiltersAllow(filter) {
-		l.withSource().Debugln(args...)
-	}
+	l.logln(logrus.DebugLevel, []string{filter}, args...)
 }
 
 // DebugFilterf will log debug only if 'filter' was previously added via UpdateFilter of AddFilter
 func (l *logger) DebugFilterf(filter string, fmt string, args ...interface{}) {
-	if l.FiltersAllow(filter) {
-		l.withSource().Debugf(fmt, args...)
-	}
+	l.logf(logrus.DebugLevel, []string{filter}, fmt, args...)
 }
 
 // DebugFilters will log info only if one of 'filters' was previously added via UpdateFilter of AddFilter
 func (l *logger) DebugFilters(filters []string, args ...interface{}) {
-	if l.FiltersAllow(filters...) {
-		l.withSource().Debug(args...)
-	}
+	l.log(logrus.DebugLevel, topics(filters), args...)
 }
 
 // DebugFilterLn will log debug only if one of 'filters' was previously added via UpdateFilter of AddFilter
 func (l *logger) DebugFiltersLn(filters []string, args ...interface{}) {
-	if l.FiltersAllow(filters...) {
-		l.withSource().Debugln(args...)
-	}
+	l.logln(logrus.DebugLevel, topics(filters), args...)
 }
 
 // DebugFilterf will log debug only if one of 'filters' was previously added via UpdateFilter of AddFilter
 func (l *logger) DebugFiltersf(filters []string, fmt string, args ...interface{}) {
-	if l.FiltersAllow(filters...) {
-		l.withSource().Debugf(fmt, args...)
-	}
+	l.logf(logrus.DebugLevel, topics(filters), fmt, args...)
 }
 
 func (l *logger) Info(args ...interface{}) {
-	l.withSource().Info(args...)
+	l.log(logrus.InfoLevel, nil, args...)
 }
 
 func (l *logger) Infoln(args ...interface{}) {
-	l.withSource().Infoln(args...)
+	l.logln(logrus.InfoLevel, nil, args...)
 }
 
 func (l *logger) Infof(msg string, args ...interface{}) {
-	l.withSource().Infof(msg, args...)
+	l.logf(logrus.InfoLevel, nil, msg, args...)
 }
 
 // InfoFilter will log info only if 'filter' was previously added via UpdateFilter of AddFilter
 func (l *logger) InfoFilter(filter string, args ...interface{}) {
-	if l.FiltersAllow(filter) {
-		l.withSource().Info(args...)
-	}
+	l.log(logrus.InfoLevel, []string{filter}, args...)
 }
 
 // InfoFilterLn will log info only if 'filter' was previously added via UpdateFilter of AddFilter
 func (l *logger) InfoFilterLn(filter string, args ...interface{}) {
-	if l.FiltersAllow(filter) {
-		l.withSource().Infoln(args...)
-	}
+	l.logln(logrus.InfoLevel, []string{filter}, args...)
 }
 
 // InfoFilterf will log info only if 'filter' was previously added via UpdateFilter of AddFilter
 func (l *logger) InfoFilterf(filter string, fmt string, args ...interface{}) {
-	if l.FiltersAllow(filter) {
-		l.withSource().Infof(fmt, args...)
-	}
+	l.logf(logrus.InfoLevel, []string{filter}, fmt, args...)
 }
 
 // InfoFilters will log info only if one of 'filters' was previously added via UpdateFilter of AddFilter
 func (l *logger) InfoFilters(filters []string, args ...interface{}) {
-	if l.FiltersAllow(filters...) {
-		l.withSource().Info(args...)
-	}
+	l.log(logrus.InfoLevel, topics(filters), args...)
 }
 
 // InfoFilterLn will log info only if one of 'filters' was previously added via UpdateFilter of AddFilter
 func (l *logger) InfoFiltersLn(filters []string, args ...interface{}) {
-	if l.FiltersAllow(filters...) {
-		l.withSource().Infoln(args...)
-	}
+	l.logln(logrus.InfoLevel, topics(filters), args...)
 }
 
 // InfoFilterf will log info only if one of 'filters' was previously added via UpdateFilter of AddFilter
 func (l *logger) InfoFiltersf(filters []string, fmt string, args ...interface{}) {
-	if l.FiltersAllow(filters...) {
-		l.withSource().Infof(fmt, args...)
-	}
+	l.logf(logrus.InfoLevel, topics(filters), fmt, args...)
 }
 
 func (l *logger) RemoveFilter(filter string) {
@@ -168,15 +146,15 @@ func (l *logger) FiltersAllow(filters ...string) bool {
 }
 
 func (l *logger) Warn(args ...interface{}) {
-	l.withSource().Warn(args...)
+	l.log(logrus.WarnLevel, nil, args...)
 }
 
 func (l *logger) Warnln(args ...interface{}) {
-	l.withSource().Warnln(args...)
+	l.logln(logrus.WarnLevel, nil, args...)
 }
 
 func (l *logger) Warnf(fmt string, args ...interface{}) {
-	l.withSource().Warnf(fmt, args...)
+	l.logf(logrus.WarnLevel, nil, fmt, args...)
 }
 
 func (l *logger) incrementErrorCounter() {
@@ -185,47 +163,69 @@ func (l *logger) incrementErrorCounter() {
 
 func (l *logger) Error(args ...interface{}) {
 
-	l.withSource().Error(args...)
+	l.log(logrus.ErrorLevel, nil, args...)
 }
 
 func (l *logger) Errorln(args ...interface{}) {
-	l.withSource().Errorln(args...)
+	l.logln(logrus.ErrorLevel, nil, args...)
 }
 
 func (l *logger) Errorf(fmt string, args ...interface{}) {
-	l.withSource().Errorf(fmt, args...)
+	l.logf(logrus.ErrorLevel, nil, fmt, args...)
 }
 
 func (l *logger) Fatal(args ...interface{}) {
-	l.withSource().Fatal(args...)
+	l.log(logrus.FatalLevel, nil, args...)
 }
 
 func (l *logger) Fatalln(args ...interface{}) {
-	l.withSource().Fatalln(args...)
+	l.logln(logrus.FatalLevel, nil, args...)
 }
 
 func (l *logger) Fatalf(fmt string, args ...interface{}) {
-	l.withSource().Fatalf(fmt, args...)
+	l.logf(logrus.FatalLevel, nil, fmt, args...)
 }
 
 func (l *logger) Panic(args ...interface{}) {
-	l.withSource().Panic(args...)
+	l.log(logrus.PanicLevel, nil, args...)
 }
 
 func (l *logger) Panicln(args ...interface{}) {
-	l.withSource().Panicln(args...)
+	l.logln(logrus.PanicLevel, nil, args...)
 }
 
 func (l *logger) Panicf(fmt string, args ...interface{}) {
-	l.withSource().Panicf(fmt, args...)
+	l.logf(logrus.PanicLevel, nil, fmt, args...)
 }
 
 func (l *logger) With(key string, value interface{}) Logger {
-	return &logger{origLogger, l.entry.WithField(key, value), l.fmt, l.logFilter}
+	c := *l
+	c.entry = l.entry.WithField(key, value)
+	return &c
 }
 
 func (l *logger) WithFields(fields map[string]interface{}) Logger {
-	return &logger{origLogger, l.entry.WithFields(logrus.Fields(fields)), l.fmt, l.logFilter}
+	c := *l
+	c.entry = l.entry.WithFields(logrus.Fields(fields))
+	return &c
+}
+
+// WithCallerSkip returns a logger that attributes entries to the caller 'skip'
+// frames further up the stack, for use by wrappers around logsift. A negative
+// skip undoes an earlier one, never skipping fewer frames than none.
+func (l *logger) WithCallerSkip(skip int) ExtendedLogger {
+	c := *l
+	c.skip = max(c.skip+skip, 0)
+	return &c
+}
+
+// WithFlightRecorder returns a logger that keeps the entries it does not log,
+// because their level is disabled or their filters are not set, in 'fr' and
+// writes them out before its next error, fatal or panic entry.
+func (l *logger) WithFlightRecorder(fr *FlightRecorder) ExtendedLogger {
+	c := *l
+	c.recorder = fr
+	return &c
 }
 
 func AddHook(hook logrus.Hook) {
@@ -236,36 +236,181 @@ func Entry() *logrus.Entry {
 	return defaultLogger.entry
 }
 
-func (l *logger) withSource() *logrus.Entry {
-	if l.fmt == "none" {
-		return l.entry
+// topics marks a logging call as filtered even if 'filters' is nil, a nil
+// filters argument to log, logln and logf means the call is unfiltered.
+func topics(filters []string) []string {
+	if filters == nil {
+		return []string{}
+	}
+	return filters
+}
+
+// enabled reports whether an entry at 'level' with 'filters' is logged, a
+// field filter matching the fields of l turns on all levels and filters
+func (l *logger) enabled(level logrus.Level, filters []string) bool {
+	if l.levelEnabled(level) {
+		if filters == nil || l.FiltersAllow(filters...) {
+			return true
+		}
+		if x := loadOptions().filterExpr; x != nil && x.matches(level, filters, l.entry.Data) {
+			return true
+		}
 	}
-	_, file, line, ok := runtime.Caller(2)
-	if !ok {
-		file = "<???>"
-		line = 1
+	return l.fieldsMatch()
+}
+
+func (l *logger) log(level logrus.Level, filters []string, args ...interface{}) {
+	if !l.enabled(level, filters) {
+		noteTopics(filters, false, l.skip)
+		if l.recorder != nil || tailWants(level, filters) {
+			l.keep(level, filters, fmt.Sprint(args...), l.recorder)
+		}
+		return
+	}
+	entry, ok := l.withSource(level, filters)
+	noteTopics(filters, ok, l.skip)
+	if ok {
+		l.write(entry, level, filters, fmt.Sprint(args...))
+	} else if tailWants(level, filters) {
+		l.keep(level, filters, fmt.Sprint(args...), nil)
+	}
+}
+
+func (l *logger) logln(level logrus.Level, filters []string, args ...interface{}) {
+	if !l.enabled(level, filters) {
+		noteTopics(filters, false, l.skip)
+		if l.recorder != nil || tailWants(level, filters) {
+			msg := fmt.Sprintln(args...)
+			l.keep(level, filters, msg[:len(msg)-1], l.recorder)
+		}
+		return
+	}
+	entry, ok := l.withSource(level, filters)
+	noteTopics(filters, ok, l.skip)
+	if ok {
+		msg := fmt.Sprintln(args...)
+		l.write(entry, level, filters, msg[:len(msg)-1])
+	} else if tailWants(level, filters) {
+		msg := fmt.Sprintln(args...)
+		l.keep(level, filters, msg[:len(msg)-1], nil)
+	}
+}
+
+func (l *logger) logf(level logrus.Level, filters []string, format string, args ...interface{}) {
+	if !l.enabled(level, filters) {
+		noteTopics(filters, false, l.skip)
+		if l.recorder != nil || tailWants(level, filters) {
+			l.keep(level, filters, fmt.Sprintf(format, args...), l.recorder)
+		}
+		return
+	}
+	entry, ok := l.withSource(level, filters)
+	noteTopics(filters, ok, l.skip)
+	if ok {
+		l.write(entry, level, filters, fmt.Sprintf(format, args...))
+	} else if tailWants(level, filters) {
+		l.keep(level, filters, fmt.Sprintf(format, args...), nil)
+	}
+}
+
+func (l *logger) write(entry *logrus.Entry, level logrus.Level, filters []string, msg string) {
+	if l.recorder != nil && level <= logrus.ErrorLevel {
+		l.recorder.Flush()
+	}
+	if tailWants(level, filters) {
+		publishTail(entry, level, filters, msg)
+	}
+	if l.IsLevelEnabled(level) {
+		entry.Log(level, msg)
 	} else {
-		if l.fmt == "short" {
-			slash := strings.LastIndex(file, "/")
-			file = file[slash+1:]
+		writeBelowLevel(entry.WithTime(time.Now()), level, msg)
+	}
+	if level == logrus.FatalLevel {
+		l.Exit(1)
+	}
+}
+
+// keep passes an entry that is not logged to the flight recorder 'fr', if
+// any, and the live tails, with its source resolved now as the stack is gone
+// by the time it is written.
+func (l *logger) keep(level logrus.Level, filters []string, msg string, fr *FlightRecorder) {
+	var source interface{}
+	o := loadOptions()
+	if o.sourceFormat != "none" {
+		if cs := callerSite(l.skip); cs != nil {
+			source = cs.source(o)
 		}
 	}
+	entry := l.entryWith(o, filters, source)
+	if fr != nil {
+		fr.add(entry, level, msg)
+	}
+	if tailWants(level, filters) {
+		publishTail(entry, level, filters, msg)
+	}
+}
+
+// withSource resolves the caller of the logging method and attaches it as the
+// "source" field. It applies call site sampling and the rate limits of
+// 'filters', returning false if the entry is suppressed.
+func (l *logger) withSource(level logrus.Level, filters []string) (*logrus.Entry, bool) {
+	o, s := loadOptions(), sampling.Load()
+	if o.sourceFormat == "none" && s == nil {
+		if !rateLimits.allow(level, filters) {
+			return nil, false
+		}
+		return l.entryWith(o, filters, nil), true
+	}
+	cs := callerSite(l.skip)
+	if s != nil && cs != nil && !s.allow(cs, level) {
+		return nil, false
+	}
+	if !rateLimits.allow(level, filters) {
+		return nil, false
+	}
+	if o.sourceFormat == "none" {
+		return l.entryWith(o, filters, nil), true
+	}
+	if cs == nil {
+		return l.entryWith(o, filters, Source{File: "<???>", Line: 1}), true
+	}
 
-	return l.entry.WithField("source", fmt.Sprintf(" %s:%d ", file, line))
+	return l.entryWith(o, filters, cs.source(o)), true
 }
 
-// sets the output format to 'json'|'text'|'nocolor' .. only supported for now
-func SetFormat(format string) {
-	switch format {
-	case "json":
-		defaultLogger.entry.Logger.Formatter = &logrus.JSONFormatter{}
-	case "nocolor":
-		defaultLogger.entry.Logger.Formatter = &logrus.TextFormatter{ForceColors: false, DisableColors: true}
-	case "forceColor":
-		defaultLogger.entry.Logger.Formatter = &logrus.TextFormatter{ForceColors: true, DisableColors: false}
-	default:
-		defaultLogger.entry.Logger.Formatter = &logrus.TextFormatter{}
+// entryWith returns the entry of l with the "source" field, unless source is
+// nil, and the topics of a filtered call in the field set by SetFilterField
+func (l *logger) entryWith(o *options, filters []string, source interface{}) *logrus.Entry {
+	if len(filters) == 0 || o.filterField == "" {
+		if source == nil {
+			return l.entry
+		}
+		return l.entry.WithField("source", source)
 	}
+	fields := logrus.Fields{o.filterField: strings.Join(filters, ",")}
+	if source != nil {
+		fields["source"] = source
+	}
+	return l.entry.WithFields(fields)
+}
+
+// adds the topics of filtered entries, comma separated, in the field 'name'
+// such as "filter". Off by default, an empty name turns it off
+func SetFilterField(name string) {
+	updateOptions(func(o *options) {
+		o.filterField = name
+	})
+}
+
+// gets the field carrying the topics of filtered entries, empty if off
+func GetFilterField() string {
+	return loadOptions().filterField
+}
+
+// sets the output format to 'json'|'text'|'nocolor'|'forceColor' or one of
+// the structured json presets 'ecs'|'gcp'|'datadog'
+func SetFormat(format string) {
+	defaultSink.setFormat(format)
 }
 
 // Logger is interface used for logging
@@ -321,93 +466,116 @@ type Logger interface {
 	With(key string, value interface{}) Logger
 }
 
+// ExtendedLogger is implemented by the loggers of this package on top of
+// Logger, whose other implementations, such as mocks, need not provide it:
+//
+//	if x, ok := log.(logsift.ExtendedLogger); ok {
+//		x.V(2).Info("connected")
+//	}
+type ExtendedLogger interface {
+	Logger
+
+	V(level int) Verbose
+
+	WithCallerSkip(skip int) ExtendedLogger
+	WithFlightRecorder(fr *FlightRecorder) ExtendedLogger
+}
+
 // set log output
 func SetOutput(out io.Writer) {
-	defaultLogger.entry.Logger.Out = out
+	defaultSink.setOutput(out)
 }
 
-// set the source format output to either 'long'|'short'
+// set the source format output to either 'long'|'short'|'func'|'none'
 func SetSourceFormat(format string) {
 	switch format {
-	case "short":
-		defaultLogger.fmt = format
-	case "long":
-		defaultLogger.fmt = format
+	case "short", "long", "func", "none":
 	default:
-		defaultLogger.fmt = "short"
+		format = "short"
 	}
+	updateOptions(func(o *options) {
+		o.sourceFormat = format
+	})
 }
 
 // set logging level
 func SetLevel(level string) {
 	lvl, err := logrus.ParseLevel(level)
 	if err != nil {
-		defaultLogger.entry.Logger.Level = logrus.InfoLevel
+		defaultLogger.entry.Logger.SetLevel(logrus.InfoLevel)
 		return
 	}
-	defaultLogger.entry.Logger.Level = lvl
+	defaultLogger.entry.Logger.SetLevel(lvl)
 }
 
 func SetAllowEmptyFilter(allow bool) {
 	defaultLogger.logFilter.SetAllowEmptyFilter(allow)
 }
 
+// GetAllowEmptyFilter reports whether filtered entries are logged when no
+// filters are set
+func GetAllowEmptyFilter() bool {
+	if f, ok := defaultLogger.logFilter.(filterSnapshot); ok {
+		_, allow := f.snapshot()
+		return allow
+	}
+	return false
+}
+
+// GetFilters returns a copy of the filters, a filter mapped to false is
+// turned off, see UpdateFilter
+func GetFilters() map[string]bool {
+	if f, ok := defaultLogger.logFilter.(filterSnapshot); ok {
+		filters, _ := f.snapshot()
+		return filters
+	}
+	return map[string]bool{}
+}
+
 func IsDebugEnabled() bool {
-	return defaultLogger.Level == logrus.DebugLevel
+	return defaultLogger.GetLevel() == logrus.DebugLevel
 }
 
 func GetLevel() (level string) {
-	level = defaultLogger.entry.Logger.Level.String()
+	level = defaultLogger.entry.Logger.GetLevel().String()
 	return level
 }
 
-// get the source format output 'long'|'short'
+// get the source format output 'long'|'short'|'func'|'none'
 func GetSourceFormat() (format string) {
-	format = defaultLogger.fmt
+	format = loadOptions().sourceFormat
 	return format
 }
 
-// gets the output format to 'json'|'text'|'nocolor'
+// gets the output format 'json'|'text'|'nocolor'|'forceColor' or the preset name
 func GetFormat() (format string) {
-	switch v := defaultLogger.entry.Logger.Formatter.(type) {
-	case *logrus.JSONFormatter:
-		{
-			format = "json"
-		}
-	case *logrus.TextFormatter:
-		{
-			if !v.ForceColors && v.DisableColors {
-				format = "nocolor"
-			} else {
-				format = "text"
-			}
-		}
-	}
-	return format
+	defaultSink.Lock()
+	defer defaultSink.Unlock()
+	return defaultSink.format
 }
 
 func Debug(args ...interface{}) {
-	defaultLogger.withSource().Debug(args...)
+	defaultLogger.log(logrus.DebugLevel, nil, args...)
 }
 
 func Debugln(args ...interface{}) {
-	defaultLogger.withSource().Debugln(args...)
+	defaultLogger.logln(logrus.DebugLevel, nil, args...)
 }
 
 func Debugf(msg string, args ...interface{}) {
-	defaultLogger.withSource().Debugf(msg, args...)
+	defaultLogger.logf(logrus.DebugLevel, nil, msg, args...)
 }
 
 func Info(args ...interface{}) {
-	defaultLogger.withSource().Info(args...)
+	defaultLogger.log(logrus.InfoLevel, nil, args...)
 }
 
 func Infoln(args ...interface{}) {
-	defaultLogger.withSource().Infoln(args...)
+	defaultLogger.logln(logrus.InfoLevel, nil, args...)
 }
 
 func Infof(msg string, args ...interface{}) {
-	defaultLogger.withSource().Infof(msg, args...)
+	defaultLogger.logf(logrus.InfoLevel, nil, msg, args...)
 }
 
 // remove a filter
@@ -427,110 +595,110 @@ func UpdateFilter(filter map[string]bool) {
 
 // DebugFilter will log debug only if 'filter' was previously added via UpdateFilter of AddFilter
 func DebugFilter(filter string, args ...interface{}) {
-	defaultLogger.DebugFilter(filter, args...)
+	defaultLogger.log(logrus.DebugLevel, []string{filter}, args...)
 }
 
 // DebugFilterLn will log debug only if 'filter' was previously added via UpdateFilter of AddFilter
 func DebugFilterLn(filter string, args ...interface{}) {
-	defaultLogger.DebugFilterLn(filter, args...)
+	defaultLogger.logln(logrus.DebugLevel, []string{filter}, args...)
 }
 
 // DebugFilterf will log debug only if 'filter' was previously added via UpdateFilter of AddFilter
 func DebugFilterf(filter string, fmt string, args ...interface{}) {
-	defaultLogger.DebugFilterf(filter, fmt, args...)
+	defaultLogger.logf(logrus.DebugLevel, []string{filter}, fmt, args...)
 }
 
 // DebugFilter will log debug only if one of 'filters' was previously added via UpdateFilter of AddFilter
 func DebugFilters(filters []string, args ...interface{}) {
-	defaultLogger.DebugFilters(filters, args...)
+	defaultLogger.log(logrus.DebugLevel, topics(filters), args...)
 }
 
 // DebugFilterLn will log debug only if one of 'filters' was previously added via UpdateFilter of AddFilter
 func DebugFiltersLn(filters []string, args ...interface{}) {
-	defaultLogger.DebugFiltersLn(filters, args...)
+	defaultLogger.logln(logrus.DebugLevel, topics(filters), args...)
 }
 
 // DebugFilterf will log debug only if one of 'filters' was previously added via UpdateFilter of AddFilter
 func DebugFiltersf(filters []string, fmt string, args ...interface{}) {
-	defaultLogger.DebugFiltersf(filters, fmt, args...)
+	defaultLogger.logf(logrus.DebugLevel, topics(filters), fmt, args...)
 }
 
 // InfoFilter will log info only if 'filter' was previously added via UpdateFilter of AddFilter
 func InfoFilter(filter string, args ...interface{}) {
-	defaultLogger.InfoFilter(filter, args...)
+	defaultLogger.log(logrus.InfoLevel, []string{filter}, args...)
 }
 
 // InfoFilterLn will log info only if 'filter' was previously added via UpdateFilter of AddFilter
 func InfoFilterLn(filter string, args ...interface{}) {
-	defaultLogger.InfoFilterLn(filter, args...)
+	defaultLogger.logln(logrus.InfoLevel, []string{filter}, args...)
 }
 
 // InfoFilterf will log info only if 'filter' was previously added via UpdateFilter of AddFilter
 func InfoFilterf(filter string, fmt string, args ...interface{}) {
-	defaultLogger.InfoFilterf(filter, fmt, args...)
+	defaultLogger.logf(logrus.InfoLevel, []string{filter}, fmt, args...)
 }
 
 // InfoFilter will log info only if one of 'filters' was previously added via UpdateFilter of AddFilter
 func InfoFilters(filters []string, args ...interface{}) {
-	defaultLogger.InfoFilters(filters, args...)
+	defaultLogger.log(logrus.InfoLevel, topics(filters), args...)
 }
 
 // InfoFilterLn will log info only if one of 'filters' was previously added via UpdateFilter of AddFilter
 func InfoFiltersLn(filters []string, args ...interface{}) {
-	defaultLogger.InfoFiltersLn(filters, args...)
+	defaultLogger.logln(logrus.InfoLevel, topics(filters), args...)
 }
 
 // InfoFilterf will log info only if one of 'filters' was previously added via UpdateFilter of AddFilter
 func InfoFiltersf(filters []string, fmt string, args ...interface{}) {
-	defaultLogger.InfoFiltersf(filters, fmt, args...)
+	defaultLogger.logf(logrus.InfoLevel, topics(filters), fmt, args...)
 }
 
 func Warn(args ...interface{}) {
-	defaultLogger.withSource().Warn(args...)
+	defaultLogger.log(logrus.WarnLevel, nil, args...)
 }
 
 func Warnln(args ...interface{}) {
-	defaultLogger.withSource().Warnln(args...)
+	defaultLogger.logln(logrus.WarnLevel, nil, args...)
 }
 
 func Warnf(msg string, args ...interface{}) {
-	defaultLogger.withSource().Warnf(msg, args...)
+	defaultLogger.logf(logrus.WarnLevel, nil, msg, args...)
 }
 
 func Error(args ...interface{}) {
-	defaultLogger.withSource().Error(args...)
+	defaultLogger.log(logrus.ErrorLevel, nil, args...)
 }
 
 func Errorln(args ...interface{}) {
-	defaultLogger.withSource().Errorln(args...)
+	defaultLogger.logln(logrus.ErrorLevel, nil, args...)
 }
 
 func Errorf(msg string, args ...interface{}) {
-	defaultLogger.withSource().Errorf(msg, args...)
+	defaultLogger.logf(logrus.ErrorLevel, nil, msg, args...)
 }
 
 func Fatal(args ...interface{}) {
-	defaultLogger.withSource().Fatal(args...)
+	defaultLogger.log(logrus.FatalLevel, nil, args...)
 }
 
 func Fatalln(args ...interface{}) {
-	defaultLogger.withSource().Fatalln(args...)
+	defaultLogger.logln(logrus.FatalLevel, nil, args...)
 }
 
 func Fatalf(msg string, args ...interface{}) {
-	defaultLogger.withSource().Fatalf(msg, args...)
+	defaultLogger.logf(logrus.FatalLevel, nil, msg, args...)
 }
 
 func Panic(args ...interface{}) {
-	defaultLogger.withSource().Panic(args...)
+	defaultLogger.log(logrus.PanicLevel, nil, args...)
 }
 
 func Panicln(args ...interface{}) {
-	defaultLogger.withSource().Panicln(args...)
+	defaultLogger.logln(logrus.PanicLevel, nil, args...)
 }
 
 func Panicf(msg string, args ...interface{}) {
-	defaultLogger.withSource().Panicf(msg, args...)
+	defaultLogger.logf(logrus.PanicLevel, nil, msg, args...)
 }
 
 // Default returns the default logger instance.
@@ -542,6 +710,18 @@ func With(key string, value interface{}) Logger {
 	return defaultLogger.With(key, value)
 }
 
+// WithCallerSkip returns a logger that attributes entries to the caller 'skip'
+// frames further up the stack, for use by wrappers around logsift.
+func WithCallerSkip(skip int) ExtendedLogger {
+	return defaultLogger.WithCallerSkip(skip)
+}
+
+// WithFlightRecorder returns a default logger keeping the entries it does not
+// log in 'fr' until its next error, see FlightRecorder.
+func WithFlightRecorder(fr *FlightRecorder) ExtendedLogger {
+	return defaultLogger.WithFlightRecorder(fr)
+}
+
 type Fields map[string]interface{}
 
 func WithFields(fields map[string]interface{}) Logger {
@@ -549,43 +729,31 @@ func WithFields(fields map[string]interface{}) Logger {
 }
 
 // Handler is an http handler for exposing log configuration.
-// you can modify the logging via ?level&format&sourceFormat
+// you can modify the logging via ?level&format&sourceFormat&sourceStructured,
+// nothing is changed if any parameter is invalid and the response is a 400.
+// Clients accepting json get the resulting State.
+// Mounted on a subtree such as "/log/", ".../state" reports the State,
+// ".../topics" lists the filter topics, see Topics, ".../tail" streams entries
+// as server-sent events, see Tail, and ".../ui" is an admin page.
 func Handler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if level := r.FormValue("level"); level != "" {
-			Warn("updating log level to ", level)
-			SetLevel(level)
-		}
-		if format := r.FormValue("format"); format != "" {
-			Warn("updating format to ", format)
-			SetFormat(format)
-		}
-		if sourceFormat := r.FormValue("sourceFormat"); sourceFormat != "" {
-			Warn("updating sourceFormat to ", sourceFormat)
-			SetSourceFormat(sourceFormat)
-		}
-		if enabledFilters := r.FormValue("filter"); enabledFilters != "" {
-			Warn("updating filter to ", enabledFilters)
-			UpdateFilter(ParseFilters(enabledFilters))
-		}
-		if allowEmpty := r.FormValue("allowEmptyFilter"); allowEmpty != "" {
-			allow, err := strconv.ParseBool(allowEmpty)
-			if err != nil {
-				Warn("invalid value for allow empty filter: ", allowEmpty)
-				return
-			}
-			Warn("updating allow empty filter to ", allow)
-			SetAllowEmptyFilter(allow)
-		}
-		if resetFilter := r.FormValue("resetFilter"); resetFilter != "" {
-			reset, err := strconv.ParseBool(resetFilter)
-			if err != nil {
-				Warn("invalid value for reset filter: ", resetFilter)
+		switch path.Base(r.URL.Path) {
+		case "state":
+			serveState(w, r)
+		case "topics":
+			serveTopics(w, r)
+		case "tail":
+			serveTail(w, r)
+		case "ui":
+			serveUI(w, r)
+		default:
+			if err := applySettings(r.FormValue); err != nil {
+				Warn(err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
-			if reset {
-				Warn("resetting filter")
-				UpdateFilter(make(map[string]bool))
+			if acceptsJSON(r) {
+				serveState(w, r)
 			}
 		}
 	})
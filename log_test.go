@@ -16,9 +16,23 @@ func setupTest(t *testing.T) *bytes.Buffer {
 	SetOutput(buf)
 	SetLevel("debug")
 	SetFormat("json")
+	SetSanitize("auto")
+	SetDedup(0)
 	SetSourceFormat("short")
+	SetSourceStructured(false)
+	SetSourceTrimPrefix("")
 	SetAllowEmptyFilter(false)
 	UpdateFilter(make(map[string]bool))
+	SetFilterExpr("")
+	SetFilterField("")
+	ResetFieldFilters()
+	SetLevelDirectives("")
+	SetVerbosity(0)
+	SetVModule("")
+	SetFieldFilterTTL(0)
+	resetRedaction()
+	SetSampling(0, 0, 0)
+	SetFilterRateLimits(nil)
 	return buf
 }
 
@@ -365,6 +379,58 @@ func TestFilteredLog_AfterUpdateFilter(t *testing.T) {
 	}
 }
 
+func TestFilteredLog_FilterField(t *testing.T) {
+	buf := setupTest(t)
+	AddFilter("db")
+
+	DebugFilter("db", "off by default")
+	if entry := parseLogEntry(t, buf); entry["filter"] != nil {
+		t.Errorf("expected no filter field by default, got %v", entry["filter"])
+	}
+
+	buf.Reset()
+	SetFilterField("filter")
+	DebugFilters([]string{"db", "auth"}, "query")
+	if entry := parseLogEntry(t, buf); entry["filter"] != "db,auth" {
+		t.Errorf("expected filter field 'db,auth', got %v", entry["filter"])
+	}
+
+	buf.Reset()
+	SetSourceFormat("none")
+	Debug("unfiltered")
+	if entry := parseLogEntry(t, buf); entry["filter"] != nil {
+		t.Errorf("expected no filter field, got %v", entry["filter"])
+	}
+
+	req := httptest.NewRequest("GET", "/log?filterField=topics", nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+	buf.Reset()
+	DebugFilter("db", "renamed")
+	if entry := parseLogEntry(t, buf); entry["topics"] != "db" || entry["filter"] != nil {
+		t.Errorf("expected topics field, got %v", entry)
+	}
+	req = httptest.NewRequest("GET", "/log?filterField=none", nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if got := GetFilterField(); got != "" {
+		t.Errorf("expected filter field off, got %q", got)
+	}
+}
+
+func TestFilteredLog_UpdateFilterFalse(t *testing.T) {
+	buf := setupTest(t)
+	SetAllowEmptyFilter(true)
+
+	UpdateFilter(map[string]bool{"db": false})
+	DebugFilter("db", "turned off")
+	if buf.Len() != 0 {
+		t.Error("expected 'db' mapped to false to be blocked")
+	}
+	DebugFilter("auth", "allowed")
+	if buf.Len() == 0 {
+		t.Error("expected 'auth' to pass with empty filters allowed")
+	}
+}
+
 // --- HTTP Handler tests ---
 
 func TestHandler_SetLevel(t *testing.T) {
@@ -450,6 +516,33 @@ func TestHandler_ResetFilter(t *testing.T) {
 	}
 }
 
+func TestHandler_AddRemoveFilter(t *testing.T) {
+	buf := setupTest(t)
+
+	AddFilter("auth")
+	handler := Handler()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/log?addFilter=db,cache", nil))
+	for _, filter := range []string{"auth", "db", "cache"} {
+		buf.Reset()
+		DebugFilter(filter, "on")
+		if buf.Len() == 0 {
+			t.Errorf("expected filter %q to be enabled", filter)
+		}
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/log?removeFilter=auth,cache", nil))
+	buf.Reset()
+	DebugFilter("auth", "off")
+	DebugFilter("cache", "off")
+	if buf.Len() != 0 {
+		t.Errorf("expected auth and cache to be disabled, got %s", buf)
+	}
+	DebugFilter("db", "on")
+	if buf.Len() == 0 {
+		t.Error("expected db to stay enabled")
+	}
+}
+
 func TestHandler_AllowEmptyFilter(t *testing.T) {
 	buf := setupTest(t)
 
@@ -0,0 +1,57 @@
+package logsift
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// options is an immutable snapshot of the configuration read while logging.
+// Setters copy the current snapshot, change the copy and swap it in, so a
+// logging call sees one consistent set of options without locking.
+type options struct {
+	// 'short'|'long'|'func'|'none', see SetSourceFormat
+	sourceFormat string
+	// prefix stripped from 'long' source paths, see SetSourceTrimPrefix
+	sourceTrimPrefix string
+	// emit the source as an object in json output, see SetSourceStructured
+	sourceStructured bool
+	// per package levels, nil if none, see SetLevelDirectives
+	levels *levelDirectives
+	// up to which V logs, see SetVerbosity
+	verbosity int
+	// verbosity by source file, nil if none, see SetVModule
+	vmodule *vmodule
+	// field carrying the topics of filtered entries, empty if off, see
+	// SetFilterField
+	filterField string
+	// compiled filter expression, nil if none, see SetFilterExpr
+	filterExpr *filterExpr
+	// entries matching these are logged at all levels, see AddFieldFilter
+	fieldFilters []FieldFilter
+	// TTL of field filters added without one, see SetFieldFilterTTL
+	fieldFilterTTL time.Duration
+}
+
+var (
+	// serializes setters so concurrent updates are not lost
+	optionsMu      sync.Mutex
+	currentOptions atomic.Pointer[options]
+)
+
+func init() {
+	currentOptions.Store(&options{sourceFormat: "short", fieldFilterTTL: DefaultFieldFilterTTL})
+}
+
+func loadOptions() *options {
+	return currentOptions.Load()
+}
+
+// updateOptions applies fn to a copy of the current options and publishes it
+func updateOptions(fn func(o *options)) {
+	optionsMu.Lock()
+	defer optionsMu.Unlock()
+	o := *currentOptions.Load()
+	fn(&o)
+	currentOptions.Store(&o)
+}
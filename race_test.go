@@ -0,0 +1,103 @@
+package logsift
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// handlerRequests cycles through the settings a runtime change may touch.
+var handlerRequests = []string{
+	"/log?level=info&format=json&sourceFormat=long",
+	"/log?level=debug&format=text&sourceFormat=func&sourceStructured=true",
+	"/log?sourceFormat=none&filter=db,auth&allowEmptyFilter=true",
+	"/log?sourceFormat=short&sourceStructured=false&format=ecs&sanitize=escape",
+	"/log?dedup=10ms&sampling=5:2:10ms&rateLimit=db:1000",
+	"/log?dedup=off&sampling=off&rateLimit=off&resetFilter=true",
+	"/log?redactRules=keys,email&format=gcp",
+	"/log?redactRules=keys,jwt,credit_card,email&format=nocolor&level=trace",
+}
+
+func TestRace_HandlerWhileLogging(t *testing.T) {
+	setupTest(t)
+	SetSuppressionSummary(0)
+	defer SetSuppressionSummary(time.Minute)
+
+	const loggers, iterations = 8, 300
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	for g := 0; g < loggers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			l := WithFlightRecorder(NewFlightRecorder(8, 0)).With("goroutine", g)
+			for i := 0; i < iterations; i++ {
+				l.Debug("debug ", i)
+				l.Infof("info %d", i)
+				l.DebugFilter("db", "query ", i)
+				l.InfoFilters([]string{"auth", "cache"}, "login ", i)
+				l.WithFields(map[string]interface{}{"password": "x", "n": i}).Warn("fields")
+				if i%50 == 0 {
+					l.Error("failure ", i)
+				}
+				Info("package level ", i)
+			}
+		}(g)
+	}
+
+	var admin sync.WaitGroup
+	admin.Add(1)
+	go func() {
+		defer admin.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			req := httptest.NewRequest("GET", handlerRequests[i%len(handlerRequests)], nil)
+			Handler().ServeHTTP(httptest.NewRecorder(), req)
+			if i%10 == 0 {
+				SetOutput(&bytes.Buffer{})
+				SetSourceTrimPrefix(fmt.Sprint("/tmp/", i))
+				AddSink("race", &bytes.Buffer{}, "json")
+			}
+			_, _, _ = GetLevel(), GetFormat(), GetSourceFormat()
+		}
+	}()
+
+	wg.Wait()
+	close(stop)
+	admin.Wait()
+	RemoveSink("race")
+}
+
+func TestRace_OptionsSnapshotConsistent(t *testing.T) {
+	setupTest(t)
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			SetSourceFormat([]string{"short", "long", "func", "none"}[i%4])
+			SetSourceStructured(i%2 == 0)
+		}
+	}()
+	for i := 0; i < 10000; i++ {
+		if o := loadOptions(); o.sourceFormat == "" {
+			t.Fatal("expected a source format in every snapshot")
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,143 @@
+package logsift
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var FlightRecorderCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "service_log_flight_recorder_counter",
+	Help: "count of log entries recorded, evicted, dropped and flushed by flight recorders",
+}, []string{"event"})
+
+const (
+	// default number of entries kept by a flight recorder
+	DefaultFlightRecorderEntries = 256
+	// approximate bytes an entry occupies besides its message
+	recordOverhead = 128
+)
+
+// record is an entry kept by a flight recorder
+type record struct {
+	entry *logrus.Entry
+	level logrus.Level
+	msg   string
+	size  int
+}
+
+// FlightRecorder is a ring buffer of the entries a logger did not write, because
+// their level was disabled or their filters were not set. The buffered entries
+// are written, marked "retroactive", before the next error, fatal or panic
+// entry of a logger using the recorder, so an error comes with the debug lines
+// leading up to it. Use one recorder per request or goroutine, see
+// WithFlightRecorder and NewContext.
+type FlightRecorder struct {
+	mu       sync.Mutex
+	records  []record
+	start, n int
+	bytes    int
+	maxBytes int
+}
+
+// NewFlightRecorder keeps the last 'entries' entries taking up to about
+// 'maxBytes' bytes. Entries <= 0 keeps DefaultFlightRecorderEntries, maxBytes
+// <= 0 bounds the recorder by entries only.
+func NewFlightRecorder(entries, maxBytes int) *FlightRecorder {
+	if entries <= 0 {
+		entries = DefaultFlightRecorderEntries
+	}
+	return &FlightRecorder{records: make([]record, entries), maxBytes: max(maxBytes, 0)}
+}
+
+// add records msg, evicting the oldest entries to stay within the bounds
+func (fr *FlightRecorder) add(entry *logrus.Entry, level logrus.Level, msg string) {
+	r := record{entry: entry, level: level, msg: msg, size: len(msg) + recordOverhead}
+	if entry.Time.IsZero() {
+		e := *entry
+		e.Time = time.Now()
+		r.entry = &e
+	}
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	if fr.maxBytes > 0 && r.size > fr.maxBytes {
+		FlightRecorderCounter.WithLabelValues("dropped").Inc()
+		return
+	}
+	for fr.n == len(fr.records) || (fr.maxBytes > 0 && fr.bytes+r.size > fr.maxBytes) {
+		fr.evict()
+	}
+	fr.records[(fr.start+fr.n)%len(fr.records)] = r
+	fr.n++
+	fr.bytes += r.size
+	FlightRecorderCounter.WithLabelValues("recorded").Inc()
+}
+
+// pop removes the oldest entry, the recorder must be locked
+func (fr *FlightRecorder) pop() record {
+	r := fr.records[fr.start]
+	fr.records[fr.start] = record{}
+	fr.start = (fr.start + 1) % len(fr.records)
+	fr.n--
+	fr.bytes -= r.size
+	return r
+}
+
+func (fr *FlightRecorder) evict() {
+	fr.pop()
+	FlightRecorderCounter.WithLabelValues("evicted").Inc()
+}
+
+// Len returns the number of buffered entries.
+func (fr *FlightRecorder) Len() int {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	return fr.n
+}
+
+// Reset drops the buffered entries without writing them.
+func (fr *FlightRecorder) Reset() {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	for fr.n > 0 {
+		fr.pop()
+	}
+}
+
+// Flush writes the buffered entries, oldest first, with the field
+// "retroactive" set. They bypass the level and filters, see writeBelowLevel.
+func (fr *FlightRecorder) Flush() {
+	fr.mu.Lock()
+	records := make([]record, 0, fr.n)
+	for fr.n > 0 {
+		records = append(records, fr.pop())
+	}
+	fr.mu.Unlock()
+
+	for _, r := range records {
+		writeBelowLevel(r.entry.WithField("retroactive", true), r.level, r.msg)
+	}
+	if len(records) > 0 {
+		FlightRecorderCounter.WithLabelValues("flushed").Add(float64(len(records)))
+	}
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying logger, e.g. one using a flight
+// recorder for the lifetime of a request.
+func NewContext(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, the default logger if none.
+func FromContext(ctx context.Context) Logger {
+	if l, ok := ctx.Value(contextKey{}).(Logger); ok {
+		return l
+	}
+	return defaultLogger
+}
@@ -0,0 +1,200 @@
+package logsift
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+)
+
+func TestFlightRecorder_FlushesOnError(t *testing.T) {
+	buf := setupTest(t)
+	SetLevel("info")
+	l := WithFlightRecorder(NewFlightRecorder(10, 0)).With("request", "r1")
+
+	l.Debug("opening connection")
+	l.Debugf("query took %dms", 12)
+	l.Info("handling request")
+	line := callerLine() + 1
+	l.Error("query failed")
+
+	entries := parseLogEntries(t, buf)
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d: %s", len(entries), buf.String())
+	}
+	want := []struct {
+		msg, level  string
+		retroactive bool
+	}{
+		{"handling request", "info", false},
+		{"opening connection", "debug", true},
+		{"query took 12ms", "debug", true},
+		{"query failed", "error", false},
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e["msg"] != w.msg || e["level"] != w.level {
+			t.Errorf("entry %d: expected %s %q, got %v %v", i, w.level, w.msg, e["level"], e["msg"])
+		}
+		if _, ok := e["retroactive"]; ok != w.retroactive {
+			t.Errorf("entry %d: expected retroactive %v, got %v", i, w.retroactive, e["retroactive"])
+		}
+		if e["request"] != "r1" {
+			t.Errorf("entry %d: expected request field, got %v", i, e["request"])
+		}
+	}
+	if want := fmt.Sprintf("recorder_test.go:%d", line); sourceLine(t, entries[3]) != want {
+		t.Errorf("expected source %q, got %q", want, sourceLine(t, entries[3]))
+	}
+	if src, _ := entries[1]["source"].(string); !strings.Contains(src, "recorder_test.go:") {
+		t.Errorf("expected retroactive entry to keep its source, got %q", src)
+	}
+}
+
+func TestFlightRecorder_Hooks(t *testing.T) {
+	setupTest(t)
+	SetLevel("info")
+	hook := addTestHook(t)
+	l := WithFlightRecorder(NewFlightRecorder(10, 0))
+
+	l.Debug("buffered")
+	l.Error("failed")
+
+	entries := hook.AllEntries()
+	if len(entries) != 2 || entries[0].Message != "buffered" || entries[0].Data["retroactive"] != true {
+		t.Fatalf("expected hook to see the retroactive entry first, got %v", entries)
+	}
+	if entries[0].Level != logrus.DebugLevel {
+		t.Errorf("expected retroactive entry to keep its level, got %s", entries[0].Level)
+	}
+}
+
+func TestFlightRecorder_FilteredOut(t *testing.T) {
+	buf := setupTest(t)
+	fr := NewFlightRecorder(10, 0)
+	l := WithFlightRecorder(fr)
+	l.AddFilter("db")
+
+	l.DebugFilter("db", "logged")
+	l.DebugFilter("cache", "cache miss")
+	l.InfoFilters(nil, "no filters")
+
+	if fr.Len() != 2 {
+		t.Fatalf("expected 2 recorded entries, got %d", fr.Len())
+	}
+	l.Error("boom")
+	entries := parseLogEntries(t, buf)
+	if len(entries) != 4 || entries[1]["msg"] != "cache miss" || entries[2]["msg"] != "no filters" {
+		t.Errorf("expected filtered out entries before the error, got %s", buf.String())
+	}
+	if fr.Len() != 0 {
+		t.Errorf("expected recorder to be empty after flush, got %d", fr.Len())
+	}
+}
+
+func TestFlightRecorder_Bounds(t *testing.T) {
+	setupTest(t)
+	SetLevel("info")
+	fr := NewFlightRecorder(3, 0)
+	l := WithFlightRecorder(fr)
+	for i := 0; i < 5; i++ {
+		l.Debug("line ", i)
+	}
+	if fr.Len() != 3 {
+		t.Errorf("expected 3 entries, got %d", fr.Len())
+	}
+
+	fr = NewFlightRecorder(100, 2*recordOverhead+20)
+	l = WithFlightRecorder(fr)
+	for i := 0; i < 5; i++ {
+		l.Debug("0123456789")
+	}
+	if fr.Len() != 2 {
+		t.Errorf("expected 2 entries within the byte bound, got %d", fr.Len())
+	}
+	before := testutil.ToFloat64(FlightRecorderCounter.WithLabelValues("dropped"))
+	l.Debug(strings.Repeat("x", 2*recordOverhead))
+	if got := testutil.ToFloat64(FlightRecorderCounter.WithLabelValues("dropped")) - before; got != 1 {
+		t.Errorf("expected oversized entry to be dropped, got %v", got)
+	}
+}
+
+func TestFlightRecorder_NotUsedWithoutRecorder(t *testing.T) {
+	buf := setupTest(t)
+	SetLevel("info")
+	Debug("dropped")
+	Error("boom")
+	if got := countLines(buf.String()); got != 1 {
+		t.Errorf("expected only the error, got %s", buf.String())
+	}
+}
+
+func TestFlightRecorder_Redacts(t *testing.T) {
+	buf := setupTest(t)
+	SetLevel("info")
+	l := WithFlightRecorder(NewFlightRecorder(10, 0))
+	l.With("password", "hunter2").Debug("login")
+	l.Error("failed")
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("expected retroactive entry to be redacted, got %s", buf.String())
+	}
+}
+
+func TestFlightRecorder_Metrics(t *testing.T) {
+	setupTest(t)
+	SetLevel("info")
+	recorded := testutil.ToFloat64(FlightRecorderCounter.WithLabelValues("recorded"))
+	flushed := testutil.ToFloat64(FlightRecorderCounter.WithLabelValues("flushed"))
+	l := WithFlightRecorder(NewFlightRecorder(10, 0))
+	l.Debug("a")
+	l.Debug("b")
+	l.Error("c")
+	if got := testutil.ToFloat64(FlightRecorderCounter.WithLabelValues("recorded")) - recorded; got != 2 {
+		t.Errorf("expected 2 recorded, got %v", got)
+	}
+	if got := testutil.ToFloat64(FlightRecorderCounter.WithLabelValues("flushed")) - flushed; got != 2 {
+		t.Errorf("expected 2 flushed, got %v", got)
+	}
+}
+
+func TestFlightRecorder_Context(t *testing.T) {
+	buf := setupTest(t)
+	SetLevel("info")
+	if FromContext(context.Background()) != Default() {
+		t.Errorf("expected default logger without a logger in the context")
+	}
+	ctx := NewContext(context.Background(), WithFlightRecorder(NewFlightRecorder(10, 0)))
+	FromContext(ctx).Debug("step 1")
+	FromContext(ctx).Error("failed")
+	if got := countLines(buf.String()); got != 2 {
+		t.Errorf("expected retroactive entry and error, got %s", buf.String())
+	}
+}
+
+func TestFlightRecorder_Concurrent(t *testing.T) {
+	setupTest(t)
+	SetLevel("info")
+	fr := NewFlightRecorder(16, 0)
+	l := WithFlightRecorder(fr)
+	done := make(chan struct{})
+	for g := 0; g < 4; g++ {
+		go func(g int) {
+			defer func() { done <- struct{}{} }()
+			for i := 0; i < 100; i++ {
+				l.Debug(fmt.Sprint(g, i))
+				if i%25 == 0 {
+					l.Error("boom")
+				}
+			}
+		}(g)
+	}
+	for g := 0; g < 4; g++ {
+		<-done
+	}
+	if fr.Len() > 16 {
+		t.Errorf("expected at most 16 entries, got %d", fr.Len())
+	}
+}
@@ -0,0 +1,434 @@
+package logsift
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+// Redacted replaces masked values in log output.
+const Redacted = "[REDACTED]"
+
+// maximum depth of nested maps, slices and structs walked by redaction
+const redactMaxDepth = 8
+
+var RedactionCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "service_log_redaction_counter",
+	Help: "count of values masked by each log redaction rule",
+}, []string{"rule"})
+
+// RedactionRule masks sensitive data in entries before they are formatted.
+// A rule masks whole fields by key, parts of string values by pattern, or both.
+type RedactionRule struct {
+	// Name identifies the rule in metrics and the admin handler
+	Name string
+	// Keys are case-insensitive glob patterns, in path.Match syntax, matched
+	// against field names and the keys of nested maps and structs
+	Keys []string
+	// Pattern masks every match in string values and the message
+	Pattern *regexp.Regexp
+	// Valid optionally confirms a Pattern match before it is masked
+	Valid func(match string) bool
+	// Disabled installs the rule off, to be enabled by SetRedactionRules
+	Disabled bool
+}
+
+// DefaultRedactionRules are installed at startup. Only 'keys' and 'jwt' are
+// enabled, 'credit_card' and 'email' scan every string and mask look-alikes,
+// so they are opt-in.
+func DefaultRedactionRules() []RedactionRule {
+	return []RedactionRule{
+		{
+			Name: "keys",
+			Keys: []string{"password", "passwd", "secret", "*_secret", "token", "*_token",
+				"authorization", "cookie", "api_key", "apikey", "private_key"},
+		},
+		{
+			Name:    "jwt",
+			Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+		},
+		{
+			Name:     "credit_card",
+			Pattern:  regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+			Valid:    cardValid,
+			Disabled: true,
+		},
+		{
+			Name:     "email",
+			Pattern:  regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+			Disabled: true,
+		},
+	}
+}
+
+type redactionRule struct {
+	RedactionRule
+	enabled bool
+	keys    []string
+}
+
+type redactor struct {
+	sync.Mutex
+	rules atomic.Pointer[[]*redactionRule]
+}
+
+var redaction = newRedactor(DefaultRedactionRules())
+
+func newRedactor(rules []RedactionRule) *redactor {
+	r := &redactor{}
+	compiled := compileRedactionRules(rules)
+	r.rules.Store(&compiled)
+	return r
+}
+
+func compileRedactionRules(rules []RedactionRule) []*redactionRule {
+	compiled := make([]*redactionRule, 0, len(rules))
+	for _, rule := range rules {
+		compiled = append(compiled, compileRedactionRule(rule))
+	}
+	return compiled
+}
+
+func compileRedactionRule(rule RedactionRule) *redactionRule {
+	keys := make([]string, 0, len(rule.Keys))
+	for _, key := range rule.Keys {
+		if key != "" {
+			keys = append(keys, strings.ToLower(key))
+		}
+	}
+	return &redactionRule{RedactionRule: rule, enabled: !rule.Disabled, keys: keys}
+}
+
+// update applies fn to a copy of the rule set and publishes it
+func (r *redactor) update(fn func(rules []*redactionRule) ([]*redactionRule, error)) error {
+	r.Lock()
+	defer r.Unlock()
+	rules := append([]*redactionRule(nil), *r.rules.Load()...)
+	rules, err := fn(rules)
+	if err != nil {
+		return err
+	}
+	r.rules.Store(&rules)
+	return nil
+}
+
+// AddRedactionRule installs a rule, replacing any rule with the same name.
+func AddRedactionRule(rule RedactionRule) error {
+	if err := validRedactionRule(rule); err != nil {
+		return err
+	}
+	compiled := compileRedactionRule(rule)
+	return redaction.update(func(rules []*redactionRule) ([]*redactionRule, error) {
+		for i, existing := range rules {
+			if existing.Name == rule.Name {
+				rules[i] = compiled
+				return rules, nil
+			}
+		}
+		return append(rules, compiled), nil
+	})
+}
+
+func validRedactionRule(rule RedactionRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("redaction rule needs a name")
+	}
+	if len(rule.Keys) == 0 && rule.Pattern == nil {
+		return fmt.Errorf("redaction rule %q needs keys or a pattern", rule.Name)
+	}
+	for _, key := range rule.Keys {
+		if _, err := path.Match(key, ""); err != nil {
+			return fmt.Errorf("redaction rule %q: invalid key pattern %q: %w", rule.Name, key, err)
+		}
+	}
+	return nil
+}
+
+// RemoveRedactionRule uninstalls the rule with the given name.
+func RemoveRedactionRule(name string) {
+	_ = redaction.update(func(rules []*redactionRule) ([]*redactionRule, error) {
+		res := rules[:0]
+		for _, rule := range rules {
+			if rule.Name != name {
+				res = append(res, rule)
+			}
+		}
+		return res, nil
+	})
+}
+
+// SetRedactKeys replaces the key patterns of the built-in 'keys' rule.
+func SetRedactKeys(keys ...string) error {
+	return AddRedactionRule(RedactionRule{Name: "keys", Keys: keys})
+}
+
+// SetRedactionRules enables exactly the named rules and disables all others.
+func SetRedactionRules(names ...string) error {
+	enable := make(map[string]bool, len(names))
+	for _, name := range names {
+		enable[name] = true
+	}
+	return redaction.update(func(rules []*redactionRule) ([]*redactionRule, error) {
+		for _, rule := range rules {
+			delete(enable, rule.Name)
+		}
+		for name := range enable {
+			return nil, fmt.Errorf("unknown redaction rule %q", name)
+		}
+		for i, rule := range rules {
+			on := false
+			for _, name := range names {
+				on = on || rule.Name == name
+			}
+			if on != rule.enabled {
+				updated := *rule
+				updated.enabled = on
+				rules[i] = &updated
+			}
+		}
+		return rules, nil
+	})
+}
+
+// GetRedactionRules returns the names of the enabled redaction rules.
+func GetRedactionRules() []string {
+	var names []string
+	for _, rule := range *redaction.rules.Load() {
+		if rule.enabled {
+			names = append(names, rule.Name)
+		}
+	}
+	return names
+}
+
+// redactionHook masks entries before they reach other hooks and the formatter.
+// Entries handed to hooks carry their own copy of Data, nested values are
+// copied on change, so nothing the caller passed in is modified.
+type redactionHook struct{}
+
+func (redactionHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (redactionHook) Fire(entry *logrus.Entry) error {
+	rules := *redaction.rules.Load()
+	entry.Message = redactString(rules, entry.Message)
+	for k, v := range entry.Data {
+		if masked, ok := redactField(rules, k, v, 0); ok {
+			entry.Data[k] = masked
+		}
+	}
+	return nil
+}
+
+// redactField masks a keyed value, reporting whether it changed
+func redactField(rules []*redactionRule, key string, v interface{}, depth int) (interface{}, bool) {
+	if rule := matchKey(rules, key); rule != nil {
+		RedactionCounter.WithLabelValues(rule.Name).Inc()
+		return Redacted, true
+	}
+	return redactValue(rules, v, depth)
+}
+
+func matchKey(rules []*redactionRule, key string) *redactionRule {
+	lower := strings.ToLower(key)
+	for _, rule := range rules {
+		if !rule.enabled {
+			continue
+		}
+		for _, pattern := range rule.keys {
+			if ok, _ := path.Match(pattern, lower); ok {
+				return rule
+			}
+		}
+	}
+	return nil
+}
+
+func redactString(rules []*redactionRule, s string) string {
+	for _, rule := range rules {
+		if !rule.enabled || rule.Pattern == nil {
+			continue
+		}
+		s = rule.Pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if rule.Valid != nil && !rule.Valid(match) {
+				return match
+			}
+			RedactionCounter.WithLabelValues(rule.Name).Inc()
+			return Redacted
+		})
+	}
+	return s
+}
+
+// redactValue walks v, reporting whether anything was masked. Structs that
+// need masking come back as a map of their exported fields.
+func redactValue(rules []*redactionRule, v interface{}, depth int) (interface{}, bool) {
+	if depth > redactMaxDepth {
+		return v, false
+	}
+	switch v := v.(type) {
+	case nil, bool, int, int64, float64, Source:
+		return v, false
+	case string:
+		masked := redactString(rules, v)
+		return masked, masked != v
+	case error:
+		msg := v.Error()
+		if masked := redactString(rules, msg); masked != msg {
+			return masked, true
+		}
+		return v, false
+	case json.Marshaler, encoding.TextMarshaler, fmt.Stringer:
+		return v, false
+	}
+	return redactReflect(rules, reflect.ValueOf(v), depth)
+}
+
+func redactReflect(rules []*redactionRule, rv reflect.Value, depth int) (interface{}, bool) {
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return rv.Interface(), false
+		}
+		if masked, ok := redactValue(rules, rv.Elem().Interface(), depth+1); ok {
+			return masked, true
+		}
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		var res map[string]interface{}
+		iter := rv.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			if masked, ok := redactField(rules, key, iter.Value().Interface(), depth+1); ok {
+				if res == nil {
+					res = make(map[string]interface{}, rv.Len())
+				}
+				res[key] = masked
+			}
+		}
+		if res != nil {
+			for iter = rv.MapRange(); iter.Next(); {
+				if _, ok := res[iter.Key().String()]; !ok {
+					res[iter.Key().String()] = iter.Value().Interface()
+				}
+			}
+			return res, true
+		}
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		var res []interface{}
+		for i := 0; i < rv.Len(); i++ {
+			masked, ok := redactValue(rules, rv.Index(i).Interface(), depth+1)
+			if ok && res == nil {
+				res = make([]interface{}, rv.Len())
+				for j := 0; j < i; j++ {
+					res[j] = rv.Index(j).Interface()
+				}
+			}
+			if res != nil {
+				res[i] = masked
+			}
+		}
+		if res != nil {
+			return res, true
+		}
+	case reflect.Struct:
+		return redactStruct(rules, rv, depth)
+	}
+	return rv.Interface(), false
+}
+
+func redactStruct(rules []*redactionRule, rv reflect.Value, depth int) (interface{}, bool) {
+	t := rv.Type()
+	res := make(map[string]interface{}, t.NumField())
+	changed := false
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		masked, ok := redactField(rules, name, rv.Field(i).Interface(), depth+1)
+		changed = changed || ok
+		res[name] = masked
+	}
+	if !changed {
+		return rv.Interface(), false
+	}
+	return res, true
+}
+
+// cardValid reports whether s holds the digits of a card number with the
+// issuer prefix and length of a major network, passing the Luhn checksum, so
+// timestamps and ids of the same length are mostly kept.
+func cardValid(s string) bool {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+	return cardIssuer(digits) && luhnValid(digits)
+}
+
+// cardIssuer reports whether the prefix and length of 'digits' are those of
+// Visa, Mastercard, American Express or Discover
+func cardIssuer(digits string) bool {
+	n := len(digits)
+	if n < 13 {
+		return false
+	}
+	switch p2, p3, p4 := digits[:2], digits[:3], digits[:4]; {
+	case digits[0] == '4':
+		return n == 13 || n == 16 || n == 19
+	case p2 >= "51" && p2 <= "55", p4 >= "2221" && p4 <= "2720":
+		return n == 16
+	case p2 == "34", p2 == "37":
+		return n == 15
+	case p4 == "6011", p2 == "65", p3 >= "644" && p3 <= "649":
+		return n >= 16
+	}
+	return false
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum, so only
+// plausible card numbers are masked.
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
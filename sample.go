@@ -0,0 +1,339 @@
+package logsift
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var SuppressedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "service_log_suppressed_counter",
+	Help: "count of log entries suppressed by sampling or filter rate limits",
+}, []string{"reason", "filter"})
+
+// sampler lets the first entries per tick through at every call site, then
+// every 'thereafter'th.
+type sampler struct {
+	first      uint64
+	thereafter uint64
+	tick       time.Duration
+}
+
+// active sampler, nil if sampling is off
+var sampling atomic.Pointer[sampler]
+
+// SetSampling logs the first 'first' entries per call site and 'tick', then
+// every 'thereafter'th entry (none if 0). Fatal and panic entries are never
+// sampled. A 'first' of 0 turns sampling off.
+func SetSampling(first, thereafter int, tick time.Duration) {
+	if first <= 0 || tick <= 0 {
+		sampling.Store(nil)
+		return
+	}
+	sampling.Store(&sampler{first: uint64(first), thereafter: uint64(max(thereafter, 0)), tick: tick})
+	startSuppressionSummary()
+}
+
+// GetSampling returns the sampling settings, all zero if sampling is off.
+func GetSampling() (first, thereafter int, tick time.Duration) {
+	if s := sampling.Load(); s != nil {
+		return int(s.first), int(s.thereafter), s.tick
+	}
+	return 0, 0, 0
+}
+
+func (s *sampler) allow(cs *callsite, level logrus.Level) bool {
+	if level <= logrus.FatalLevel {
+		return true
+	}
+	n := s.count(cs, time.Now().UnixNano())
+	if n <= s.first || (s.thereafter > 0 && (n-s.first)%s.thereafter == 0) {
+		return true
+	}
+	cs.suppressed.Add(1)
+	SuppressedCounter.WithLabelValues("sampling", "").Inc()
+	return false
+}
+
+// count increments the call site counter, resetting it once per tick
+func (s *sampler) count(cs *callsite, now int64) uint64 {
+	resetAt := cs.sampleResetAt.Load()
+	if resetAt > now {
+		return cs.sampleCount.Add(1)
+	}
+	if !cs.sampleResetAt.CompareAndSwap(resetAt, now+s.tick.Nanoseconds()) {
+		return cs.sampleCount.Add(1)
+	}
+	cs.sampleCount.Store(1)
+	return 1
+}
+
+// RateLimit is a token bucket refilled at PerSecond up to Burst tokens.
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+func (r RateLimit) String() string {
+	return fmt.Sprintf("%g:%d", r.PerSecond, r.Burst)
+}
+
+type bucket struct {
+	sync.Mutex
+	limit      RateLimit
+	tokens     float64
+	last       time.Time
+	suppressed atomic.Uint64
+}
+
+func newBucket(limit RateLimit) *bucket {
+	if limit.Burst <= 0 {
+		limit.Burst = max(1, int(math.Ceil(limit.PerSecond)))
+	}
+	return &bucket{limit: limit, tokens: float64(limit.Burst), last: time.Now()}
+}
+
+func (b *bucket) take(now time.Time) bool {
+	b.Lock()
+	defer b.Unlock()
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*b.limit.PerSecond)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// rateLimitSet holds the token buckets of filter topics, copied on write
+type rateLimitSet struct {
+	sync.Mutex
+	buckets atomic.Pointer[map[string]*bucket]
+}
+
+var rateLimits = &rateLimitSet{}
+
+// allow takes a token from the bucket of every limited filter, fatal and
+// panic entries are never limited
+func (r *rateLimitSet) allow(level logrus.Level, filters []string) bool {
+	if len(filters) == 0 || level <= logrus.FatalLevel {
+		return true
+	}
+	buckets := r.buckets.Load()
+	if buckets == nil {
+		return true
+	}
+	now := time.Now()
+	for _, filter := range filters {
+		if b, ok := (*buckets)[filter]; ok && !b.take(now) {
+			b.suppressed.Add(1)
+			SuppressedCounter.WithLabelValues("rate_limit", filter).Inc()
+			return false
+		}
+	}
+	return true
+}
+
+// SetFilterRateLimit limits entries logged with 'filter'. A zero PerSecond
+// removes the limit.
+func SetFilterRateLimit(filter string, limit RateLimit) {
+	rateLimits.Lock()
+	defer rateLimits.Unlock()
+	buckets := make(map[string]*bucket)
+	if old := rateLimits.buckets.Load(); old != nil {
+		for k, v := range *old {
+			buckets[k] = v
+		}
+	}
+	if limit.PerSecond > 0 {
+		buckets[filter] = newBucket(limit)
+		startSuppressionSummary()
+	} else {
+		delete(buckets, filter)
+	}
+	rateLimits.buckets.Store(&buckets)
+}
+
+// SetFilterRateLimits replaces the rate limits of all filters.
+func SetFilterRateLimits(limits map[string]RateLimit) {
+	rateLimits.Lock()
+	defer rateLimits.Unlock()
+	buckets := make(map[string]*bucket, len(limits))
+	for filter, limit := range limits {
+		if limit.PerSecond > 0 {
+			buckets[filter] = newBucket(limit)
+		}
+	}
+	if len(buckets) > 0 {
+		startSuppressionSummary()
+	}
+	rateLimits.buckets.Store(&buckets)
+}
+
+// GetFilterRateLimits returns the rate limits of all filters.
+func GetFilterRateLimits() map[string]RateLimit {
+	res := make(map[string]RateLimit)
+	if buckets := rateLimits.buckets.Load(); buckets != nil {
+		for filter, b := range *buckets {
+			res[filter] = b.limit
+		}
+	}
+	return res
+}
+
+// ParseRateLimits parses 'filter:perSecond[:burst]' pairs separated by commas,
+// such as "db:100:200,auth:10".
+func ParseRateLimits(limits string) (map[string]RateLimit, error) {
+	res := make(map[string]RateLimit)
+	for _, p := range strings.Split(limits, ",") {
+		if p == "" {
+			continue
+		}
+		parts := strings.Split(p, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid rate limit %q, expected filter:perSecond[:burst]", p)
+		}
+		perSecond, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || perSecond < 0 {
+			return nil, fmt.Errorf("invalid rate for filter %q: %q", parts[0], parts[1])
+		}
+		limit := RateLimit{PerSecond: perSecond}
+		if len(parts) == 3 {
+			if limit.Burst, err = strconv.Atoi(parts[2]); err != nil || limit.Burst < 0 {
+				return nil, fmt.Errorf("invalid burst for filter %q: %q", parts[0], parts[2])
+			}
+		}
+		res[parts[0]] = limit
+	}
+	return res, nil
+}
+
+// parseSampling parses 'first:thereafter:tick' such as "100:10:1s"
+func parseSampling(s string) (first, thereafter int, tick time.Duration, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, 0, 0, fmt.Errorf("invalid sampling %q, expected first:thereafter:tick", s)
+	}
+	if first, err = strconv.Atoi(parts[0]); err != nil || first < 0 {
+		return 0, 0, 0, fmt.Errorf("invalid sampling first %q", parts[0])
+	}
+	if thereafter, err = strconv.Atoi(parts[1]); err != nil || thereafter < 0 {
+		return 0, 0, 0, fmt.Errorf("invalid sampling thereafter %q", parts[1])
+	}
+	if tick, err = time.ParseDuration(parts[2]); err != nil || tick <= 0 {
+		return 0, 0, 0, fmt.Errorf("invalid sampling tick %q", parts[2])
+	}
+	return first, thereafter, tick, nil
+}
+
+var (
+	// interval of the suppression summary line, 0 disables it
+	summaryInterval atomic.Int64
+	// summaryChanged wakes the summary goroutine when the interval changes
+	summaryChanged = make(chan struct{}, 1)
+	summaryOnce    sync.Once
+)
+
+func init() {
+	summaryInterval.Store(int64(time.Minute))
+}
+
+// SetSuppressionSummary sets how often a summary of entries suppressed by
+// sampling and rate limits is logged, 0 disables the summary.
+func SetSuppressionSummary(interval time.Duration) {
+	summaryInterval.Store(int64(interval))
+	select {
+	case summaryChanged <- struct{}{}:
+	default:
+	}
+}
+
+func startSuppressionSummary() {
+	summaryOnce.Do(func() {
+		go func() {
+			timer := time.NewTimer(0)
+			timer.Stop()
+			for {
+				// a change restarts the interval, a disabled summary waits
+				// for the next change
+				interval := time.Duration(summaryInterval.Load())
+				if interval > 0 {
+					timer.Reset(interval)
+				}
+				select {
+				case <-timer.C:
+					writeSuppressionSummary(interval)
+				case <-summaryChanged:
+					timer.Stop()
+				}
+			}
+		}()
+	})
+}
+
+// writeSuppressionSummary logs and resets the suppressed counts per call site
+// and filter, if any entries were suppressed.
+func writeSuppressionSummary(interval time.Duration) {
+	var sampled, limited uint64
+	sources := make(map[string]uint64)
+	callsites.Range(func(_, v interface{}) bool {
+		cs := v.(*callsite)
+		if n := cs.suppressed.Swap(0); n > 0 {
+			sources[strings.TrimSpace(cs.shortText)] += n
+			sampled += n
+		}
+		return true
+	})
+	filters := make(map[string]uint64)
+	if buckets := rateLimits.buckets.Load(); buckets != nil {
+		for filter, b := range *buckets {
+			if n := b.suppressed.Swap(0); n > 0 {
+				filters[filter] = n
+				limited += n
+			}
+		}
+	}
+	if sampled+limited == 0 {
+		return
+	}
+
+	fields := logrus.Fields{"sampled": sampled, "rateLimited": limited}
+	if len(sources) > 0 {
+		fields["sources"] = topCounts(sources, 10)
+	}
+	if len(filters) > 0 {
+		fields["filters"] = topCounts(filters, 10)
+	}
+	defaultLogger.entry.WithFields(fields).Warnf("suppressed %d log entries in the last %s", sampled+limited, interval)
+}
+
+// topCounts renders the n largest counts as "key=count" pairs
+func topCounts(counts map[string]uint64, n int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%d", k, counts[k])
+	}
+	return strings.Join(parts, ",")
+}
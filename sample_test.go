@@ -0,0 +1,240 @@
+package logsift
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// countLines returns the number of log lines in out.
+func countLines(out string) int {
+	return strings.Count(out, "\n")
+}
+
+// drainSuppressed resets the suppressed counts left behind by other tests.
+func drainSuppressed() {
+	callsites.Range(func(_, v interface{}) bool {
+		v.(*callsite).suppressed.Store(0)
+		return true
+	})
+}
+
+// suppressed counts the sampled entries not yet summarized
+func suppressed() uint64 {
+	var n uint64
+	callsites.Range(func(_, v interface{}) bool {
+		n += v.(*callsite).suppressed.Load()
+		return true
+	})
+	return n
+}
+
+func TestSampling_FirstThenEveryMth(t *testing.T) {
+	buf := setupTest(t)
+	SetSampling(3, 5, time.Hour)
+
+	for i := 0; i < 20; i++ {
+		Warn("retrying")
+	}
+
+	// entries 1-3, then 8, 13 and 18
+	if got := countLines(buf.String()); got != 6 {
+		t.Errorf("expected 6 sampled lines, got %d", got)
+	}
+}
+
+func TestSampling_PerCallSite(t *testing.T) {
+	buf := setupTest(t)
+	SetSampling(1, 0, time.Hour)
+
+	for i := 0; i < 5; i++ {
+		Info("first site")
+		Info("second site")
+	}
+
+	if got := countLines(buf.String()); got != 2 {
+		t.Errorf("expected one line per call site, got %d", got)
+	}
+}
+
+func TestSampling_ResetsEveryTick(t *testing.T) {
+	buf := setupTest(t)
+	SetSampling(1, 0, 20*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if i == 2 {
+			time.Sleep(30 * time.Millisecond)
+		}
+		Info("ticking")
+	}
+
+	if got := countLines(buf.String()); got != 2 {
+		t.Errorf("expected counter to reset after tick, got %d lines", got)
+	}
+}
+
+func TestSampling_NeverDropsPanic(t *testing.T) {
+	setupTest(t)
+	SetSampling(1, 0, time.Hour)
+
+	panics := 0
+	for i := 0; i < 3; i++ {
+		func() {
+			defer func() {
+				if recover() != nil {
+					panics++
+				}
+			}()
+			Panic("boom")
+		}()
+	}
+	if panics != 3 {
+		t.Errorf("expected every Panic to panic, got %d", panics)
+	}
+}
+
+func TestSampling_Off(t *testing.T) {
+	buf := setupTest(t)
+	SetSampling(1, 0, time.Hour)
+	SetSampling(0, 0, 0)
+
+	for i := 0; i < 5; i++ {
+		Info("unsampled")
+	}
+	if got := countLines(buf.String()); got != 5 {
+		t.Errorf("expected all lines with sampling off, got %d", got)
+	}
+}
+
+func TestFilterRateLimit(t *testing.T) {
+	buf := setupTest(t)
+	AddFilter("db")
+	AddFilter("auth")
+	SetFilterRateLimit("db", RateLimit{PerSecond: 0.001, Burst: 2})
+	before := testutil.ToFloat64(SuppressedCounter.WithLabelValues("rate_limit", "db"))
+
+	for i := 0; i < 5; i++ {
+		DebugFilter("db", "query")
+		DebugFilter("auth", "unlimited")
+	}
+
+	out := buf.String()
+	if got := strings.Count(out, "query"); got != 2 {
+		t.Errorf("expected burst of 2 'db' lines, got %d", got)
+	}
+	if got := strings.Count(out, "unlimited"); got != 5 {
+		t.Errorf("expected 'auth' to be unlimited, got %d", got)
+	}
+	if got := testutil.ToFloat64(SuppressedCounter.WithLabelValues("rate_limit", "db")) - before; got != 3 {
+		t.Errorf("expected 3 suppressed in metrics, got %v", got)
+	}
+
+	SetFilterRateLimit("db", RateLimit{})
+	buf.Reset()
+	DebugFilter("db", "query")
+	if buf.Len() == 0 {
+		t.Error("expected limit to be removed")
+	}
+}
+
+func TestSuppressionSummary(t *testing.T) {
+	buf := setupTest(t)
+	drainSuppressed()
+	AddFilter("db")
+	SetSampling(1, 0, time.Hour)
+	SetFilterRateLimits(map[string]RateLimit{"db": {PerSecond: 0.001, Burst: 1}})
+
+	for i := 0; i < 4; i++ {
+		Info("sampled")
+	}
+	SetSampling(0, 0, 0)
+	for i := 0; i < 3; i++ {
+		DebugFilter("db", "limited")
+	}
+
+	buf.Reset()
+	writeSuppressionSummary(time.Minute)
+	entry := parseLogEntry(t, buf)
+	if entry["sampled"] != float64(3) || entry["rateLimited"] != float64(2) {
+		t.Errorf("expected 3 sampled and 2 rate limited, got %v", entry)
+	}
+	if filters, _ := entry["filters"].(string); filters != "db=2" {
+		t.Errorf("expected filters='db=2', got %v", entry["filters"])
+	}
+	if sources, _ := entry["sources"].(string); !strings.HasPrefix(sources, "sample_test.go:") {
+		t.Errorf("expected sources to name the call site, got %v", entry["sources"])
+	}
+
+	// counts are reset after each summary
+	buf.Reset()
+	writeSuppressionSummary(time.Minute)
+	if buf.Len() != 0 {
+		t.Errorf("expected no summary without suppressed entries, got %s", buf.String())
+	}
+}
+
+func TestSuppressionSummary_Interval(t *testing.T) {
+	setupTest(t)
+	drainSuppressed()
+	defer SetSuppressionSummary(time.Minute)
+	SetSuppressionSummary(time.Hour)
+	SetSampling(1, 0, time.Hour)
+	for i := 0; i < 3; i++ {
+		Info("sampled")
+	}
+	SetSampling(0, 0, 0)
+	if suppressed() != 2 {
+		t.Fatalf("expected 2 sampled entries, got %d", suppressed())
+	}
+
+	// a shorter interval applies without waiting for the hour, the summary
+	// resetting the counts
+	SetSuppressionSummary(10 * time.Millisecond)
+	for deadline := time.Now().Add(5 * time.Second); suppressed() != 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the summary at the new interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestParseRateLimits(t *testing.T) {
+	limits, err := ParseRateLimits("db:100:200,auth:10,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits["db"] != (RateLimit{PerSecond: 100, Burst: 200}) || limits["auth"] != (RateLimit{PerSecond: 10}) {
+		t.Errorf("unexpected limits %v", limits)
+	}
+	for _, invalid := range []string{"db", "db:x", "db:1:x", ":1", "db:1:2:3"} {
+		if _, err := ParseRateLimits(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestHandler_SamplingAndRateLimit(t *testing.T) {
+	setupTest(t)
+
+	req := httptest.NewRequest("GET", "/log?sampling=100:10:1s&rateLimit=db:5:10", nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	if first, thereafter, tick := GetSampling(); first != 100 || thereafter != 10 || tick != time.Second {
+		t.Errorf("unexpected sampling %d %d %s", first, thereafter, tick)
+	}
+	if got := GetFilterRateLimits()["db"]; got != (RateLimit{PerSecond: 5, Burst: 10}) {
+		t.Errorf("unexpected rate limit %v", got)
+	}
+
+	req = httptest.NewRequest("GET", "/log?sampling=off&rateLimit=off", nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if first, _, _ := GetSampling(); first != 0 {
+		t.Error("expected sampling off")
+	}
+	if got := GetFilterRateLimits(); len(got) != 0 {
+		t.Errorf("expected no rate limits, got %v", got)
+	}
+}
@@ -0,0 +1,188 @@
+package logsift
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sanitizeMode normalizes a sanitization mode to 'auto'|'escape'|'strip'|'off',
+// unknown modes fall back to 'auto'.
+func sanitizeMode(mode string) string {
+	switch mode {
+	case "escape", "strip", "off":
+		return mode
+	default:
+		return "auto"
+	}
+}
+
+// sets how the main output sanitizes messages, keys and field values:
+// 'escape' escapes control characters and ANSI sequences the format would
+// write unquoted, 'strip' also removes ANSI sequences from quoted values,
+// 'off' writes them as is. 'auto' (default) escapes, json formats and the
+// quoted values of text formats need no escaping
+func SetSanitize(mode string) {
+	defaultSink.Lock()
+	defer defaultSink.Unlock()
+	defaultSink.sanitize = sanitizeMode(mode)
+}
+
+// gets the sanitization mode of the main output
+func GetSanitize() string {
+	defaultSink.Lock()
+	defer defaultSink.Unlock()
+	return defaultSink.sanitize
+}
+
+// sanitizeEntry returns entry, or a copy of it if the message, a key or a
+// field value contains control characters. Parts not in 'raw' are quoted by
+// the formatter and only stripped.
+func sanitizeEntry(entry *logrus.Entry, strip bool, raw rawParts) *logrus.Entry {
+	msg, changed := sanitizeString(entry.Message, strip, !raw.msg)
+	var data logrus.Fields
+	for k, v := range entry.Data {
+		key, keyChanged := sanitizeString(k, strip, !raw.keys)
+		value, valueChanged := sanitizeValue(v, strip)
+		if !keyChanged && !valueChanged {
+			continue
+		}
+		if data == nil {
+			data = make(logrus.Fields, len(entry.Data))
+			for k, v := range entry.Data {
+				data[k] = v
+			}
+		}
+		delete(data, k)
+		data[key] = value
+	}
+	if !changed && data == nil {
+		return entry
+	}
+	e := *entry
+	e.Message = msg
+	if data != nil {
+		e.Data = data
+	}
+	return &e
+}
+
+// sanitizeValue sanitizes a field value, which every format quotes
+func sanitizeValue(v interface{}, strip bool) (interface{}, bool) {
+	switch v := v.(type) {
+	case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64,
+		float32, float64, Source:
+		return v, false
+	case string:
+		return sanitizeString(v, strip, true)
+	case error:
+		if s, changed := sanitizeString(v.Error(), strip, true); changed {
+			return s, true
+		}
+		return v, false
+	default:
+		// text formatters print other values via fmt.Sprint
+		if s, changed := sanitizeString(fmt.Sprint(v), strip, true); changed {
+			return s, true
+		}
+		return v, false
+	}
+}
+
+// sanitizeString escapes control characters so a value cannot start a new log
+// line or drive the terminal. With strip, ANSI escape sequences are removed
+// instead of escaped. A quoted string is escaped by the formatter, only its
+// ANSI sequences are stripped.
+func sanitizeString(s string, strip, quoted bool) (string, bool) {
+	if quoted && !strip {
+		return s, false
+	}
+	i := 0
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if isControl(r) || (r == utf8.RuneError && size == 1) {
+			break
+		}
+		i += size
+	}
+	if i == len(s) {
+		return s, false
+	}
+
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	b.WriteString(s[:i])
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if strip && (r == '\x1b' || r == '\u009b') {
+			i += ansiSequenceLen(s[i:])
+			continue
+		}
+		if quoted {
+			b.WriteString(s[i : i+size])
+			i += size
+			continue
+		}
+		switch {
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x100 && isControl(r):
+			fmt.Fprintf(&b, `\x%02x`, r)
+		case isControl(r):
+			fmt.Fprintf(&b, `\u%04x`, r)
+		case r == utf8.RuneError && size == 1:
+			// invalid utf-8, a lone 0x9b byte is an 8-bit CSI to some terminals
+			fmt.Fprintf(&b, `\x%02x`, s[i])
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return b.String(), true
+}
+
+// isControl reports C0 and C1 control characters, DEL and the unicode line and
+// paragraph separators.
+func isControl(r rune) bool {
+	return r < 0x20 || (r >= 0x7f && r <= 0x9f) || r == '\u2028' || r == '\u2029'
+}
+
+// ansiSequenceLen returns the length of the escape sequence at the start of s:
+// CSI sequences up to their final byte, OSC/DCS strings up to their terminator,
+// or ESC and the following character.
+func ansiSequenceLen(s string) int {
+	i := 1
+	if s[0] == '\xc2' { // 8-bit CSI, U+009B
+		i = 2
+	} else if len(s) > 1 && s[1] == '[' {
+		i = 2
+	} else if len(s) > 1 && (s[1] == ']' || s[1] == 'P' || s[1] == '_' || s[1] == '^') {
+		for i = 2; i < len(s); i++ {
+			if s[i] == '\a' {
+				return i + 1
+			}
+			if s[i] == '\x1b' && i+1 < len(s) && s[i+1] == '\\' {
+				return i + 2
+			}
+		}
+		return len(s)
+	} else if len(s) > 1 {
+		_, size := utf8.DecodeRuneInString(s[1:])
+		return 1 + size
+	} else {
+		return 1
+	}
+	// CSI: parameter and intermediate bytes, then one final byte
+	for ; i < len(s); i++ {
+		if s[i] >= 0x40 && s[i] <= 0x7e {
+			return i + 1
+		}
+	}
+	return len(s)
+}
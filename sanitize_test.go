@@ -0,0 +1,151 @@
+package logsift
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// hostile payloads a user could smuggle into messages and field values
+var hostilePayloads = []string{
+	"innocent\nlevel=error msg=\"forged entry\"",
+	"carriage\rreturn",
+	"clear \x1b[2J\x1b[H screen",
+	"title \x1b]0;pwned\x07 set",
+	"c1 \u009b31m csi",
+	"line separator",
+	"bad utf8 \x9b byte",
+}
+
+// forged sequences that must not reach the output raw
+var hostileSequences = []string{"\n" + "level=error", "\r", "\x1b[2J", "\x1b]0;", "\u009b", " ", "\x9b"}
+
+func TestSanitize_EveryFormat(t *testing.T) {
+	for _, format := range []string{"json", "text", "nocolor", "forceColor", "ecs", "gcp", "datadog"} {
+		t.Run(format, func(t *testing.T) {
+			buf := setupTest(t)
+			SetFormat(format)
+			text := format == "text" || format == "nocolor" || format == "forceColor"
+
+			for _, payload := range hostilePayloads {
+				buf.Reset()
+				WithFields(map[string]interface{}{
+					"value":               payload,
+					"err":                 errors.New(payload),
+					payload[:5] + "\nkey": "x",
+				}).Warn(payload)
+
+				out := buf.String()
+				if strings.Count(out, "\n") != 1 || !strings.HasSuffix(out, "\n") {
+					t.Errorf("payload %q: expected exactly one output line, got %q", payload, out)
+				}
+				if text {
+					for _, seq := range hostileSequences {
+						if strings.Contains(out, seq) {
+							t.Errorf("payload %q: output contains raw %q: %q", payload, seq, out)
+						}
+					}
+				} else {
+					// json escapes C0 controls itself, C1 controls stay valid json
+					if strings.ContainsAny(out, "\x1b\r") {
+						t.Errorf("payload %q: output contains raw escape: %q", payload, out)
+					}
+					if !json.Valid(bytes.TrimSpace(buf.Bytes())) {
+						t.Errorf("payload %q: expected valid json, got %q", payload, out)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSanitize_Escape(t *testing.T) {
+	buf := setupTest(t)
+	SetFormat("nocolor")
+
+	Warn("a\nb \x1b[31mred")
+
+	// the message is quoted, the formatter escapes it
+	if !strings.Contains(buf.String(), `"a\nb \x1b[31mred"`) {
+		t.Errorf("expected escaped control characters, got %q", buf.String())
+	}
+}
+
+func TestSanitize_EscapeUnquoted(t *testing.T) {
+	buf := setupTest(t)
+	SetFormat("forceColor")
+
+	// colored text writes the message and keys unquoted
+	With("k\x1b[2J", "v").Warn("a\nb \x1b[31mred")
+
+	out := buf.String()
+	if !strings.Contains(out, `a\nb \x1b[31mred`) || !strings.Contains(out, `k\x1b[2J`) {
+		t.Errorf("expected escaped control characters, got %q", out)
+	}
+	if strings.Contains(out, `\\`) {
+		t.Errorf("expected no double escaping, got %q", out)
+	}
+}
+
+func TestSanitize_Strip(t *testing.T) {
+	buf := setupTest(t)
+	SetFormat("nocolor")
+	SetSanitize("strip")
+
+	Warn("a\nb \x1b[31mred\x1b[0m \x1b]0;title\x07done")
+
+	if !strings.Contains(buf.String(), `"a\nb red done"`) {
+		t.Errorf("expected ANSI sequences stripped, got %q", buf.String())
+	}
+}
+
+func TestSanitize_Off(t *testing.T) {
+	buf := setupTest(t)
+	SetFormat("forceColor")
+	SetSanitize("off")
+
+	Warn("raw \x1b[2J")
+
+	if !strings.Contains(buf.String(), "\x1b[2J") {
+		t.Errorf("expected raw sequence with sanitize off, got %q", buf.String())
+	}
+}
+
+func TestSanitize_PerSink(t *testing.T) {
+	buf := setupTest(t)
+	SetFormat("forceColor")
+	raw := &bytes.Buffer{}
+	AddSink("raw", raw, "forceColor", SinkSanitize("off"))
+	t.Cleanup(func() { RemoveSink("raw") })
+
+	Warn("clear \x1b[2J")
+
+	if strings.Contains(buf.String(), "\x1b[2J") {
+		t.Errorf("expected main output to be sanitized, got %q", buf.String())
+	}
+	if !strings.Contains(raw.String(), "\x1b[2J") {
+		t.Errorf("expected sink with sanitize off to be raw, got %q", raw.String())
+	}
+}
+
+func TestSanitize_DoesNotTouchCleanEntries(t *testing.T) {
+	entry := Entry().WithField("k", "clean")
+	entry.Message = "clean message"
+	if got := sanitizeEntry(entry, false, rawParts{keys: true, msg: true}); got != entry {
+		t.Error("expected clean entry to be returned as is")
+	}
+}
+
+func TestHandler_Sanitize(t *testing.T) {
+	setupTest(t)
+
+	req := httptest.NewRequest("GET", "/log?sanitize=strip", nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := GetSanitize(); got != "strip" {
+		t.Errorf("expected sanitize 'strip' after handler, got %q", got)
+	}
+}
@@ -0,0 +1,344 @@
+package logsift
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// setting is a runtime option shared by Handler, config files, environment
+// variables and flags. parse validates a value and returns the change, so
+// nothing is applied unless all values are valid.
+type setting struct {
+	name string
+	// flag name, also the environment variable name in upper snake case,
+	// empty if the setting is not a flag
+	flag    string
+	usage   string
+	boolean bool
+	parse   func(value string) (func() error, error)
+}
+
+// settings in the order they are applied
+var settings = []setting{
+	{name: "level", flag: "log-level",
+		usage: "log level: trace, debug, info, warn, error, fatal or panic",
+		parse: func(v string) (func() error, error) {
+			if _, err := logrus.ParseLevel(v); err != nil {
+				return nil, err
+			}
+			return func() error { SetLevel(v); return nil }, nil
+		}},
+	{name: "levels", flag: "log-levels",
+		usage: "levels by package such as 'info,github.com/acme/db/*=debug', or none",
+		parse: func(v string) (func() error, error) {
+			if v == "none" {
+				v = ""
+			} else if _, err := parseLevelDirectives(v); err != nil {
+				return nil, err
+			}
+			return func() error { return SetLevelDirectives(v) }, nil
+		}},
+	{name: "v", flag: "log-v",
+		usage: "verbosity up to which V logs",
+		parse: func(v string) (func() error, error) {
+			level, err := strconv.Atoi(v)
+			if err != nil || level < 0 {
+				return nil, fmt.Errorf("invalid verbosity %q", v)
+			}
+			return func() error { SetVerbosity(level); return nil }, nil
+		}},
+	{name: "vmodule", flag: "log-vmodule",
+		usage: "verbosity by source file such as 'server=2,db/*=4', or none",
+		parse: func(v string) (func() error, error) {
+			if v == "none" {
+				v = ""
+			} else if _, err := parseVModule(v); err != nil {
+				return nil, err
+			}
+			return func() error { return SetVModule(v) }, nil
+		}},
+	{name: "format", flag: "log-format",
+		usage: "output format: text, nocolor, forceColor, json, ecs, gcp or datadog",
+		parse: func(v string) (func() error, error) {
+			if !knownFormat(v) {
+				return nil, fmt.Errorf("unknown format %q", v)
+			}
+			return func() error { SetFormat(v); return nil }, nil
+		}},
+	{name: "sourceFormat", flag: "log-source-format",
+		usage: "source format: short, long, func or none",
+		parse: func(v string) (func() error, error) {
+			switch v {
+			case "short", "long", "func", "none":
+				return func() error { SetSourceFormat(v); return nil }, nil
+			}
+			return nil, fmt.Errorf("unknown source format %q", v)
+		}},
+	{name: "sourceStructured", flag: "log-source-structured", boolean: true,
+		usage: "emit the source as a json object",
+		parse: parseBoolSetting(SetSourceStructured)},
+	{name: "sanitize", flag: "log-sanitize",
+		usage: "sanitization of the main output: auto, escape, strip or off",
+		parse: func(v string) (func() error, error) {
+			if sanitizeMode(v) != v {
+				return nil, fmt.Errorf("unknown sanitize mode %q", v)
+			}
+			return func() error { SetSanitize(v); return nil }, nil
+		}},
+	{name: "dedup", flag: "log-dedup",
+		usage: "collapse repeated entries within a window such as 30s, or off",
+		parse: func(v string) (func() error, error) {
+			window, err := parseWindow(v)
+			if err != nil {
+				return nil, err
+			}
+			return func() error { SetDedup(window); return nil }, nil
+		}},
+	{name: "filter", flag: "log-filters",
+		usage: "comma-separated filters to enable",
+		parse: func(v string) (func() error, error) {
+			return func() error { UpdateFilter(ParseFilters(v)); return nil }, nil
+		}},
+	{name: "allowEmptyFilter", flag: "log-allow-empty-filter", boolean: true,
+		usage: "allow filtered entries when no filters are set",
+		parse: parseBoolSetting(SetAllowEmptyFilter)},
+	{name: "filterExpr", flag: "log-filter-expr",
+		usage: "expression enabling filtered entries such as 'topic:db.* && duration_ms > 100', or none",
+		parse: func(v string) (func() error, error) {
+			if v == "none" {
+				v = ""
+			} else if err := CompileFilterExpr(v); err != nil {
+				return nil, err
+			}
+			return func() error { return SetFilterExpr(v) }, nil
+		}},
+	{name: "filterField", flag: "log-filter-field",
+		usage: "field carrying the topics of filtered entries such as filter, or none",
+		parse: func(v string) (func() error, error) {
+			if v == "none" {
+				v = ""
+			}
+			return func() error { SetFilterField(v); return nil }, nil
+		}},
+	{name: "fieldFilterTTL", flag: "log-field-filter-ttl",
+		usage: "how long field filters stay on, such as 15m",
+		parse: func(v string) (func() error, error) {
+			ttl, err := time.ParseDuration(v)
+			if err != nil || ttl <= 0 {
+				return nil, fmt.Errorf("invalid duration %q", v)
+			}
+			return func() error { SetFieldFilterTTL(ttl); return nil }, nil
+		}},
+	{name: "fieldFilter", flag: "log-field-filters",
+		usage: "comma-separated key=value fields to log at all levels for the field filter TTL, or none",
+		parse: func(v string) (func() error, error) {
+			if v == "none" {
+				return func() error { ResetFieldFilters(); return nil }, nil
+			}
+			filters, err := ParseFieldFilters(v)
+			if err != nil {
+				return nil, err
+			}
+			return func() error {
+				for _, f := range filters {
+					AddFieldFilter(f.Key, f.Value, 0)
+				}
+				return nil
+			}, nil
+		}},
+	{name: "redactKeys", flag: "log-redact-keys",
+		usage: "comma-separated key patterns to redact",
+		parse: func(v string) (func() error, error) {
+			keys := strings.Split(v, ",")
+			for _, key := range keys {
+				if _, err := path.Match(key, ""); err != nil {
+					return nil, fmt.Errorf("invalid key pattern %q: %w", key, err)
+				}
+			}
+			return func() error { return SetRedactKeys(keys...) }, nil
+		}},
+	{name: "redactRules", flag: "log-redact-rules",
+		usage: "comma-separated redaction rules to enable, or none",
+		parse: func(v string) (func() error, error) {
+			var names []string
+			if v != "none" {
+				names = strings.Split(v, ",")
+			}
+			return func() error { return SetRedactionRules(names...) }, nil
+		}},
+	{name: "rateLimit", flag: "log-rate-limit",
+		usage: "filter:perSecond[:burst] pairs such as db:50:100, or off",
+		parse: func(v string) (func() error, error) {
+			limits := map[string]RateLimit{}
+			if v != "off" {
+				var err error
+				if limits, err = ParseRateLimits(v); err != nil {
+					return nil, err
+				}
+			}
+			return func() error { SetFilterRateLimits(limits); return nil }, nil
+		}},
+	{name: "sampling", flag: "log-sampling",
+		usage: "first:thereafter:tick such as 100:10:1s, or off",
+		parse: func(v string) (func() error, error) {
+			var first, thereafter int
+			var tick time.Duration
+			if v != "off" {
+				var err error
+				if first, thereafter, tick, err = parseSampling(v); err != nil {
+					return nil, err
+				}
+			}
+			return func() error { SetSampling(first, thereafter, tick); return nil }, nil
+		}},
+	{name: "resetFilter", parse: func(v string) (func() error, error) {
+		reset, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, err
+		}
+		return func() error {
+			if reset {
+				UpdateFilter(make(map[string]bool))
+			}
+			return nil
+		}, nil
+	}},
+	{name: "addFilter", parse: func(v string) (func() error, error) {
+		filters := ParseFilters(v)
+		return func() error {
+			for filter := range filters {
+				AddFilter(filter)
+			}
+			return nil
+		}, nil
+	}},
+	{name: "removeFilter", parse: func(v string) (func() error, error) {
+		filters := ParseFilters(v)
+		return func() error {
+			for filter := range filters {
+				RemoveFilter(filter)
+			}
+			return nil
+		}, nil
+	}},
+}
+
+func parseBoolSetting(set func(bool)) func(string) (func() error, error) {
+	return func(v string) (func() error, error) {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, err
+		}
+		return func() error { set(b); return nil }, nil
+	}
+}
+
+// parseWindow parses a duration, "off" is 0
+func parseWindow(v string) (time.Duration, error) {
+	if v == "off" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", v)
+	}
+	return d, nil
+}
+
+// settingChange is a validated setting value
+type settingChange struct {
+	name, value string
+	apply       func() error
+}
+
+type settingChanges []settingChange
+
+// parseSettings validates the non-empty values returned by get
+func parseSettings(get func(name string) string) (settingChanges, error) {
+	var changes settingChanges
+	for _, s := range settings {
+		v := get(s.name)
+		if v == "" {
+			continue
+		}
+		apply, err := s.parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", s.name, err)
+		}
+		changes = append(changes, settingChange{s.name, v, apply})
+	}
+	return changes, nil
+}
+
+// apply logs and applies the changes in order
+func (changes settingChanges) apply() error {
+	return changes.run(true)
+}
+
+// set applies the changes without logging them, for startup configuration
+func (changes settingChanges) set() error {
+	return changes.run(false)
+}
+
+func (changes settingChanges) run(audit bool) error {
+	for _, c := range changes {
+		if audit {
+			Warnf("updating %s to %s", c.name, c.value)
+		}
+		if err := c.apply(); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", c.name, err)
+		}
+		if audit {
+			recordConfigChange(c.name, c.value)
+		}
+	}
+	return nil
+}
+
+// ConfigChange is a setting changed via Handler, a config file reload or a
+// signal.
+type ConfigChange struct {
+	Time    time.Time `json:"time"`
+	Setting string    `json:"setting"`
+	Value   string    `json:"value"`
+}
+
+// maxConfigChanges is the number of changes kept for RecentConfigChanges
+const maxConfigChanges = 50
+
+var configChanges struct {
+	sync.Mutex
+	list []ConfigChange
+}
+
+func recordConfigChange(name, value string) {
+	configChanges.Lock()
+	defer configChanges.Unlock()
+	if len(configChanges.list) == maxConfigChanges {
+		configChanges.list = slices.Delete(configChanges.list, 0, 1)
+	}
+	configChanges.list = append(configChanges.list, ConfigChange{time.Now(), name, value})
+}
+
+// RecentConfigChanges returns the last changes, oldest first
+func RecentConfigChanges() []ConfigChange {
+	configChanges.Lock()
+	defer configChanges.Unlock()
+	return slices.Clone(configChanges.list)
+}
+
+// applySettings validates all values returned by get, then applies them
+func applySettings(get func(name string) string) error {
+	changes, err := parseSettings(get)
+	if err != nil {
+		return err
+	}
+	return changes.apply()
+}
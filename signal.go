@@ -0,0 +1,83 @@
+package logsift
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// levelToggle steps the level on signals and restores it after a timeout.
+// Changes go through applySettings, so they are validated and logged like
+// those made via Handler.
+type levelToggle struct {
+	sync.Mutex
+	restoreAfter time.Duration
+	// level before the first step, nil if nothing to restore
+	original *logrus.Level
+	timer    *time.Timer
+}
+
+// step moves the level 'delta' levels toward trace, negative deltas toward
+// panic
+func (t *levelToggle) step(delta int) {
+	t.Lock()
+	defer t.Unlock()
+	current := origLogger.GetLevel()
+	next := logrus.Level(min(max(int(current)+delta, int(logrus.PanicLevel)), int(logrus.TraceLevel)))
+	if next == current {
+		return
+	}
+	if t.original == nil {
+		t.original = &current
+	}
+	setLevelAudited(next)
+	if t.restoreAfter > 0 {
+		if t.timer != nil {
+			t.timer.Stop()
+		}
+		t.timer = time.AfterFunc(t.restoreAfter, t.restore)
+	}
+}
+
+// restore sets the level from before the first step
+func (t *levelToggle) restore() {
+	t.Lock()
+	defer t.Unlock()
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	if t.original != nil {
+		setLevelAudited(*t.original)
+		t.original = nil
+	}
+}
+
+// stop cancels a pending restore
+func (t *levelToggle) stop() {
+	t.Lock()
+	defer t.Unlock()
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+}
+
+func setLevelAudited(level logrus.Level) {
+	if err := applySettings(func(name string) string {
+		if name == "level" {
+			return level.String()
+		}
+		return ""
+	}); err != nil {
+		Warn(err)
+	}
+}
+
+// reloadOnSignal reloads the config file and reopens its file sinks
+func reloadOnSignal() {
+	if err := ReloadConfig(); err != nil {
+		Warn("reload on signal: ", err)
+	}
+}
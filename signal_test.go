@@ -0,0 +1,55 @@
+package logsift
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLevelToggle_Steps(t *testing.T) {
+	buf := setupTest(t)
+	SetLevel("info")
+	toggle := &levelToggle{}
+
+	toggle.step(1)
+	if GetLevel() != "debug" {
+		t.Errorf("expected 'debug', got %q", GetLevel())
+	}
+	toggle.step(1)
+	toggle.step(1)
+	if GetLevel() != "trace" {
+		t.Errorf("expected step to stop at 'trace', got %q", GetLevel())
+	}
+	toggle.step(-1)
+	if GetLevel() != "debug" {
+		t.Errorf("expected 'debug', got %q", GetLevel())
+	}
+	if !strings.Contains(buf.String(), "updating level to trace") {
+		t.Errorf("expected changes to be logged, got %s", buf.String())
+	}
+
+	toggle.restore()
+	if GetLevel() != "info" {
+		t.Errorf("expected original 'info' restored, got %q", GetLevel())
+	}
+}
+
+func TestLevelToggle_RestoreAfter(t *testing.T) {
+	setupTest(t)
+	SetLevel("warn")
+	toggle := &levelToggle{restoreAfter: 20 * time.Millisecond}
+	defer toggle.stop()
+
+	toggle.step(1)
+	toggle.step(1)
+	if GetLevel() != "debug" {
+		t.Fatalf("expected 'debug', got %q", GetLevel())
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for GetLevel() != "warning" && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if GetLevel() != "warning" {
+		t.Errorf("expected 'warning' restored, got %q", GetLevel())
+	}
+}
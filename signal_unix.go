@@ -0,0 +1,44 @@
+//go:build !windows
+
+package logsift
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// HandleSignals installs signal handlers: SIGUSR1 steps the level toward
+// trace, SIGUSR2 steps it back toward panic and SIGHUP reloads the config
+// file and reopens file sinks. With a 'restoreAfter' above 0 the level from
+// before the first step is restored once no step happened for that long.
+// The returned function removes the handlers.
+func HandleSignals(restoreAfter time.Duration) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGHUP)
+	toggle := &levelToggle{restoreAfter: restoreAfter}
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-ch:
+				switch sig {
+				case syscall.SIGUSR1:
+					toggle.step(1)
+				case syscall.SIGUSR2:
+					toggle.step(-1)
+				case syscall.SIGHUP:
+					reloadOnSignal()
+				}
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+		toggle.stop()
+	}
+}
@@ -0,0 +1,48 @@
+//go:build !windows
+
+package logsift
+
+import (
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond for up to two seconds.
+func waitFor(cond func() bool) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	return cond()
+}
+
+func TestHandleSignals(t *testing.T) {
+	setupTest(t)
+	resetConfig(t)
+	SetLevel("info")
+	stop := HandleSignals(0)
+	defer stop()
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	if !waitFor(func() bool { return GetLevel() == "debug" }) {
+		t.Errorf("expected SIGUSR1 to set 'debug', got %q", GetLevel())
+	}
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR2)
+	if !waitFor(func() bool { return GetLevel() == "info" }) {
+		t.Errorf("expected SIGUSR2 to set 'info', got %q", GetLevel())
+	}
+
+	path := filepath.Join(t.TempDir(), "log.yaml")
+	writeConfig(t, path, "level: warn\n")
+	if err := LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	StopConfigWatch()
+	writeConfig(t, path, "level: error\n")
+	syscall.Kill(syscall.Getpid(), syscall.SIGHUP)
+	if !waitFor(func() bool { return GetLevel() == "error" }) {
+		t.Errorf("expected SIGHUP to reload the config, got %q", GetLevel())
+	}
+}
@@ -0,0 +1,9 @@
+package logsift
+
+import "time"
+
+// HandleSignals is a no-op on windows, which has no SIGUSR1, SIGUSR2 or
+// SIGHUP.
+func HandleSignals(restoreAfter time.Duration) (stop func()) {
+	return func() {}
+}
@@ -0,0 +1,281 @@
+package logsift
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sink is an output with its own format. The main output configured through
+// SetOutput and SetFormat is the sink named "default", it is the formatter and
+// output of the logrus logger. Further sinks are added via AddSink and are
+// written by a hook, so they receive every entry that passes the level and
+// filters.
+type sink struct {
+	sync.Mutex
+	name      string
+	out       io.Writer
+	format    string
+	formatter logrus.Formatter
+	sanitize  string
+	// the parts of an entry the formatter writes unquoted
+	raw rawParts
+	buf bytes.Buffer
+	// collapses repeated entries, nil if off
+	dedup *deduper
+	// closes out once the sink stops writing to it, nil if out is not owned
+	closer io.Closer
+}
+
+// rawParts are the parts of an entry a formatter writes as is. Json formats
+// escape everything, text formats quote field values but not keys, and the
+// message only without colors.
+type rawParts struct {
+	keys, msg bool
+}
+
+// SinkOption configures a sink added via AddSink.
+type SinkOption func(*sink)
+
+// SinkSanitize sets the sanitization mode of a sink, see SetSanitize.
+func SinkSanitize(mode string) SinkOption {
+	return func(s *sink) {
+		s.sanitize = sanitizeMode(mode)
+	}
+}
+
+// sinkCloser hands the sink ownership of its writer
+func sinkCloser(c io.Closer) SinkOption {
+	return func(s *sink) {
+		s.closer = c
+	}
+}
+
+func newSink(name string, out io.Writer, format string, opts ...SinkOption) *sink {
+	s := &sink{name: name, sanitize: "auto"}
+	s.reset(out, format)
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *sink) setOutput(out io.Writer) {
+	s.Lock()
+	defer s.Unlock()
+	s.reset(out, s.format)
+}
+
+func (s *sink) setFormat(format string) {
+	s.Lock()
+	defer s.Unlock()
+	s.reset(s.out, format)
+}
+
+// reset replaces writer and format, the formatter is rebuilt so terminal
+// detection runs against the new writer.
+func (s *sink) reset(out io.Writer, format string) {
+	if s.closer != nil && out != s.out {
+		s.closer.Close()
+		s.closer = nil
+	}
+	s.out = out
+	s.format, s.formatter, s.raw = newFormatter(format, isTerminal(out))
+}
+
+// write formats entry and writes it to the sink's writer
+func (s *sink) write(entry *logrus.Entry) {
+	s.Lock()
+	defer s.Unlock()
+	if s.dedup != nil && s.dedup.repeat(s, s.out, entry) {
+		return
+	}
+	s.emit(s.out, entry)
+}
+
+// Format makes the default sink the formatter of the logrus logger. Logrus
+// sets entry.Buffer only to write the entry, formatting without it, as
+// entry.Bytes does in hooks, does not count towards dedup.
+func (s *sink) Format(entry *logrus.Entry) ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.dedup == nil || entry.Buffer == nil {
+		return s.formatter.Format(s.sanitized(entry))
+	}
+	var out bytes.Buffer
+	if !s.dedup.repeat(s, &out, entry) {
+		s.emit(&out, entry)
+	}
+	return out.Bytes(), nil
+}
+
+// close flushes state held back by the sink
+func (s *sink) close() {
+	s.Lock()
+	defer s.Unlock()
+	s.setDedup(0)
+	if s.closer != nil {
+		s.closer.Close()
+		s.closer = nil
+	}
+}
+
+// sanitized returns entry, sanitized as the sink's mode and format require
+func (s *sink) sanitized(entry *logrus.Entry) *logrus.Entry {
+	strip := s.sanitize == "strip"
+	if s.sanitize == "off" || (!strip && s.raw == rawParts{}) {
+		return entry
+	}
+	return sanitizeEntry(entry, strip, s.raw)
+}
+
+// emit formats entry and writes it to w, the sink must be locked
+func (s *sink) emit(w io.Writer, entry *logrus.Entry) {
+	e := *s.sanitized(entry)
+	s.buf.Reset()
+	e.Buffer = &s.buf
+	serialized, err := s.formatter.Format(&e)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to obtain reader, %v\n", err)
+		return
+	}
+	if _, err := w.Write(serialized); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write to log, %v\n", err)
+	}
+}
+
+// newFormatter returns the canonical name, formatter and unquoted parts for
+// an output format, unknown formats fall back to 'text'. 'tty' reports whether
+// the output is a terminal, which colors the text format.
+func newFormatter(format string, tty bool) (string, logrus.Formatter, rawParts) {
+	switch format {
+	case "json":
+		return format, &logrus.JSONFormatter{}, rawParts{}
+	case "ecs", "gcp", "datadog":
+		return format, presets[format], rawParts{}
+	case "nocolor":
+		return format, &logrus.TextFormatter{ForceColors: false, DisableColors: true}, rawParts{keys: true}
+	case "forceColor":
+		return format, &logrus.TextFormatter{ForceColors: true, DisableColors: false}, rawParts{keys: true, msg: true}
+	default:
+		// decided here rather than by the formatter, which checks the
+		// logrus logger's output
+		colored := tty && runtime.GOOS != "windows"
+		return "text", &logrus.TextFormatter{ForceColors: colored, DisableColors: !colored}, rawParts{keys: true, msg: colored}
+	}
+}
+
+// knownFormat reports whether format names an output format
+func knownFormat(format string) bool {
+	name, _, _ := newFormatter(format, false)
+	return name == format
+}
+
+// isTerminal reports whether w writes to a terminal
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// sinkWriter is the output of the logrus logger, the default sink's writer
+type sinkWriter struct {
+	s *sink
+}
+
+func (w sinkWriter) Write(p []byte) (int, error) {
+	// held back repeats format to nothing
+	if len(p) == 0 {
+		return 0, nil
+	}
+	w.s.Lock()
+	defer w.s.Unlock()
+	return w.s.out.Write(p)
+}
+
+// sinkSet holds the sinks added via AddSink
+type sinkSet struct {
+	sync.RWMutex
+	sinks []*sink
+}
+
+var (
+	defaultSink = newSink("default", os.Stderr, "text")
+	sinks       = &sinkSet{}
+)
+
+// sinkHook writes entries to the sinks added via AddSink
+type sinkHook struct{}
+
+func (sinkHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (sinkHook) Fire(entry *logrus.Entry) error {
+	sinks.RLock()
+	defer sinks.RUnlock()
+	for _, s := range sinks.sinks {
+		s.write(entry)
+	}
+	return nil
+}
+
+// AddSink writes every entry to out in addition to the main output, using its
+// own format. A sink with the same name is replaced.
+func AddSink(name string, out io.Writer, format string, opts ...SinkOption) {
+	if name == defaultSink.name {
+		SetOutput(out)
+		SetFormat(format)
+		for _, opt := range opts {
+			defaultSink.Lock()
+			opt(defaultSink)
+			defaultSink.Unlock()
+		}
+		return
+	}
+	s := newSink(name, out, format, opts...)
+	sinks.Lock()
+	defer sinks.Unlock()
+	for i, existing := range sinks.sinks {
+		if existing.name == name {
+			existing.close()
+			sinks.sinks[i] = s
+			return
+		}
+	}
+	sinks.sinks = append(sinks.sinks, s)
+}
+
+// RemoveSink stops writing to the named sink. The default sink stays.
+func RemoveSink(name string) {
+	if name == defaultSink.name {
+		return
+	}
+	sinks.Lock()
+	defer sinks.Unlock()
+	res := sinks.sinks[:0]
+	for _, s := range sinks.sinks {
+		if s.name != name {
+			res = append(res, s)
+		} else {
+			s.close()
+		}
+	}
+	sinks.sinks = res
+}
+
+func init() {
+	origLogger.Out = sinkWriter{defaultSink}
+	origLogger.Formatter = defaultSink
+	// redaction first, so the sinks write redacted entries
+	origLogger.AddHook(redactionHook{})
+	origLogger.AddHook(sinkHook{})
+}
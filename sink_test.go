@@ -0,0 +1,114 @@
+package logsift
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestAddSink_OwnFormat(t *testing.T) {
+	buf := setupTest(t)
+	extra := &bytes.Buffer{}
+	AddSink("extra", extra, "nocolor")
+	t.Cleanup(func() { RemoveSink("extra") })
+
+	With("user", "alice").Info("to both")
+
+	entry := parseLogEntry(t, buf)
+	if entry["msg"] != "to both" {
+		t.Errorf("expected main output to receive json entry, got %v", entry)
+	}
+	if !strings.Contains(extra.String(), `msg="to both"`) || !strings.Contains(extra.String(), "user=alice") {
+		t.Errorf("expected sink to receive text entry, got %q", extra.String())
+	}
+	if json.Valid(extra.Bytes()) {
+		t.Error("expected sink to use its own format, not json")
+	}
+}
+
+func TestAddSink_ReplaceAndRemove(t *testing.T) {
+	setupTest(t)
+	first, second := &bytes.Buffer{}, &bytes.Buffer{}
+	AddSink("extra", first, "json")
+	AddSink("extra", second, "json")
+	t.Cleanup(func() { RemoveSink("extra") })
+
+	Info("replaced")
+	if first.Len() != 0 {
+		t.Error("expected replaced sink to receive nothing")
+	}
+	if second.Len() == 0 {
+		t.Error("expected replacing sink to receive the entry")
+	}
+
+	RemoveSink("extra")
+	second.Reset()
+	Info("removed")
+	if second.Len() != 0 {
+		t.Error("expected removed sink to receive nothing")
+	}
+}
+
+func TestAddSink_Default(t *testing.T) {
+	setupTest(t)
+	out := &bytes.Buffer{}
+	AddSink("default", out, "nocolor", SinkSanitize("strip"))
+
+	if got := GetFormat(); got != "nocolor" {
+		t.Errorf("expected default sink format 'nocolor', got %q", got)
+	}
+	if got := GetSanitize(); got != "strip" {
+		t.Errorf("expected default sink sanitize 'strip', got %q", got)
+	}
+	Info("default")
+	if out.Len() == 0 {
+		t.Error("expected default sink writer to receive the entry")
+	}
+
+	RemoveSink("default")
+	out.Reset()
+	Info("still there")
+	if out.Len() == 0 {
+		t.Error("expected default sink not to be removable")
+	}
+}
+
+// addTestHook adds a hook recording entries to the logrus logger for the test
+func addTestHook(t *testing.T) *test.Hook {
+	logger := Entry().Logger
+	hooks := make(logrus.LevelHooks)
+	for level, h := range logger.Hooks {
+		hooks[level] = append([]logrus.Hook(nil), h...)
+	}
+	t.Cleanup(func() { logger.ReplaceHooks(hooks) })
+	return test.NewLocal(logger)
+}
+
+func TestSink_LogrusHooksAndOutput(t *testing.T) {
+	buf := setupTest(t)
+	logger := Entry().Logger
+	hook := addTestHook(t)
+
+	Warn("hooked")
+	if e := hook.LastEntry(); e == nil || e.Message != "hooked" {
+		t.Errorf("expected user hook to see the entry, got %v", e)
+	}
+	if entry := parseLogEntry(t, buf); entry["msg"] != "hooked" {
+		t.Errorf("expected main output to receive the entry, got %v", entry)
+	}
+
+	// replacing the logrus output bypasses the default sink
+	own := &bytes.Buffer{}
+	out := logger.Out
+	logger.SetOutput(own)
+	t.Cleanup(func() { logger.SetOutput(out) })
+	buf.Reset()
+	Warn("own output")
+	if buf.Len() != 0 || !strings.Contains(own.String(), "own output") {
+		t.Errorf("expected entry on the replaced output only, got %q and %q", buf.String(), own.String())
+	}
+}
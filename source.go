@@ -0,0 +1,195 @@
+package logsift
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Source is the caller location attached to every entry under the "source"
+// field. Text and json output render it as the familiar " file:line " string,
+// structured presets pick the parts apart.
+type Source struct {
+	File     string
+	Line     int
+	Function string
+	Package  string
+
+	format     string
+	structured bool
+	// preformatted String() taken from the callsite cache
+	text string
+}
+
+func (s Source) String() string {
+	if s.text != "" {
+		return s.text
+	}
+	if s.format == "func" && s.Function != "" {
+		return fmt.Sprintf(" %s:%d ", s.Function[strings.LastIndex(s.Function, "/")+1:], s.Line)
+	}
+	return fmt.Sprintf(" %s:%d ", s.File, s.Line)
+}
+
+func (s Source) MarshalJSON() ([]byte, error) {
+	if s.structured {
+		return json.Marshal(map[string]interface{}{
+			"file":     s.File,
+			"line":     s.Line,
+			"function": s.Function,
+			"package":  s.Package,
+		})
+	}
+	return json.Marshal(s.String())
+}
+
+// callsite is a resolved program counter with its source forms preformatted,
+// so logging from the same place twice only pays for the lookup.
+type callsite struct {
+	file     string
+	short    string
+	line     int
+	function string
+	pkg      string
+
+	shortText string
+	longText  string
+	funcText  string
+
+	// sampling state, see SetSampling
+	sampleCount   atomic.Uint64
+	sampleResetAt atomic.Int64
+	suppressed    atomic.Uint64
+
+	// level directive decision, see levelDirectives.siteLevel
+	levelCache atomic.Uint64
+	// vmodule decision, see vmodule.siteVerbosity
+	vCache atomic.Uint64
+}
+
+// callsites caches *callsite by program counter
+var callsites sync.Map
+
+func lookupCallsite(pc uintptr) *callsite {
+	if cs, ok := callsites.Load(pc); ok {
+		return cs.(*callsite)
+	}
+	cs, _ := callsites.LoadOrStore(pc, resolveCallsite(pc))
+	return cs.(*callsite)
+}
+
+func resolveCallsite(pc uintptr) *callsite {
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	cs := &callsite{
+		file:     frame.File,
+		short:    frame.File[strings.LastIndex(frame.File, "/")+1:],
+		line:     frame.Line,
+		function: frame.Function,
+		pkg:      funcPackage(frame.Function),
+	}
+	cs.shortText = fmt.Sprintf(" %s:%d ", cs.short, cs.line)
+	cs.longText = fmt.Sprintf(" %s:%d ", cs.file, cs.line)
+	cs.funcText = cs.shortText
+	if cs.function != "" {
+		cs.funcText = fmt.Sprintf(" %s:%d ", cs.function[strings.LastIndex(cs.function, "/")+1:], cs.line)
+	}
+	return cs
+}
+
+// source renders the callsite for the source options.
+func (cs *callsite) source(o *options) Source {
+	s := Source{
+		File:       cs.short,
+		Line:       cs.line,
+		Function:   cs.function,
+		Package:    cs.pkg,
+		format:     o.sourceFormat,
+		structured: o.sourceStructured,
+		text:       cs.shortText,
+	}
+	switch o.sourceFormat {
+	case "long":
+		s.File, s.text = cs.file, cs.longText
+		if prefix := o.sourceTrimPrefix; prefix != "" && strings.HasPrefix(cs.file, prefix) {
+			s.File, s.text = cs.file[len(prefix):], ""
+		}
+	case "func":
+		s.text = cs.funcText
+	}
+	return s
+}
+
+// funcPackage returns the import path of a fully qualified function name such
+// as "github.com/acme/app/db.(*Conn).Query".
+func funcPackage(function string) string {
+	slash := strings.LastIndex(function, "/")
+	if dot := strings.Index(function[slash+1:], "."); dot >= 0 {
+		return function[:slash+1+dot]
+	}
+	return ""
+}
+
+// set a path prefix, usually the module root, to strip from 'long' source paths
+func SetSourceTrimPrefix(prefix string) {
+	updateOptions(func(o *options) {
+		o.sourceTrimPrefix = prefix
+	})
+}
+
+// emit the source as a json object with file, line, function and package
+// instead of a single string
+func SetSourceStructured(structured bool) {
+	updateOptions(func(o *options) {
+		o.sourceStructured = structured
+	})
+}
+
+var (
+	// functions marked via Helper, skipped when resolving the source
+	helpers sync.Map
+	// number of entries in helpers, lets callerSite skip the lookups when zero
+	helperCount atomic.Int32
+)
+
+// Helper marks the calling function as a logging helper. When logsift resolves
+// the source of an entry, helper functions are skipped so the entry points at
+// the helper's caller instead, similar to testing.T.Helper.
+func Helper() {
+	var pc [1]uintptr
+	if runtime.Callers(2, pc[:]) == 0 {
+		return
+	}
+	if _, loaded := helpers.LoadOrStore(lookupCallsite(pc[0]).function, struct{}{}); !loaded {
+		helperCount.Add(1)
+	}
+}
+
+// callerSite returns the callsite of the code calling into logsift, skipping
+// frames of functions marked via Helper and 'skip' further frames.
+func callerSite(skip int) *callsite {
+	var buf [32]uintptr
+	pcs := buf[:]
+	checkHelpers := helperCount.Load() > 0
+	if !checkHelpers && skip < len(buf) {
+		pcs = buf[:skip+1]
+	}
+	// skip runtime.Callers, callerSite, withSource or keep, log and the
+	// logging method
+	n := runtime.Callers(5, pcs)
+	for _, pc := range pcs[:n] {
+		cs := lookupCallsite(pc)
+		if checkHelpers {
+			if _, helper := helpers.Load(cs.function); helper {
+				continue
+			}
+		}
+		if skip <= 0 {
+			return cs
+		}
+		skip--
+	}
+	return nil
+}
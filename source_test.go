@@ -0,0 +1,302 @@
+package logsift
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestWithSource_Func(t *testing.T) {
+	buf := setupTest(t)
+	SetSourceFormat("func")
+
+	Info("source test")
+
+	entry := parseLogEntry(t, buf)
+	source, _ := entry["source"].(string)
+	if !strings.Contains(source, "logsift.TestWithSource_Func:") {
+		t.Errorf("expected func source to name the function, got %q", source)
+	}
+}
+
+func TestWithSource_None(t *testing.T) {
+	buf := setupTest(t)
+	SetSourceFormat("none")
+	if got := GetSourceFormat(); got != "none" {
+		t.Fatalf("expected 'none', got %q", got)
+	}
+
+	Info("source test")
+
+	entry := parseLogEntry(t, buf)
+	if _, ok := entry["source"]; ok {
+		t.Errorf("expected no source field, got %v", entry["source"])
+	}
+}
+
+func TestWithSource_Structured(t *testing.T) {
+	buf := setupTest(t)
+	SetSourceStructured(true)
+
+	Info("source test")
+
+	entry := parseLogEntry(t, buf)
+	source, ok := entry["source"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected structured source object, got %v", entry["source"])
+	}
+	if source["file"] != "source_test.go" {
+		t.Errorf("expected file='source_test.go', got %v", source["file"])
+	}
+	if _, ok := source["line"].(float64); !ok {
+		t.Errorf("expected numeric line, got %v", source["line"])
+	}
+	if source["function"] != "github.com/jenish-rudani/logsift.TestWithSource_Structured" {
+		t.Errorf("unexpected function %v", source["function"])
+	}
+	if source["package"] != "github.com/jenish-rudani/logsift" {
+		t.Errorf("unexpected package %v", source["package"])
+	}
+}
+
+func TestWithSource_TrimPrefix(t *testing.T) {
+	buf := setupTest(t)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetSourceFormat("long")
+	SetSourceTrimPrefix(filepath.ToSlash(wd) + "/")
+
+	Info("source test")
+
+	entry := parseLogEntry(t, buf)
+	source, _ := entry["source"].(string)
+	if !strings.HasPrefix(source, " source_test.go:") {
+		t.Errorf("expected module-relative source, got %q", source)
+	}
+}
+
+func TestFuncPackage(t *testing.T) {
+	cases := map[string]string{
+		"github.com/acme/app/db.(*Conn).Query": "github.com/acme/app/db",
+		"github.com/acme/app.main.func1":       "github.com/acme/app",
+		"main.main":                            "main",
+		"":                                     "",
+	}
+	for function, want := range cases {
+		if got := funcPackage(function); got != want {
+			t.Errorf("funcPackage(%q) = %q, want %q", function, got, want)
+		}
+	}
+}
+
+func TestHandler_SourceStructured(t *testing.T) {
+	buf := setupTest(t)
+
+	req := httptest.NewRequest("GET", "/log?sourceStructured=true", nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	buf.Reset()
+	Info("structured")
+	entry := parseLogEntry(t, buf)
+	if _, ok := entry["source"].(map[string]interface{}); !ok {
+		t.Errorf("expected structured source after handler, got %v", entry["source"])
+	}
+}
+
+// logThroughHelper is a wrapper marked via Helper, entries should point at its caller.
+func logThroughHelper(msg string) {
+	Helper()
+	Info(msg)
+}
+
+// logThroughWrapper is an unmarked wrapper relying on WithCallerSkip.
+func logThroughWrapper(msg string) {
+	WithCallerSkip(1).Info(msg)
+}
+
+// callerLine returns the line it was called from.
+func callerLine() int {
+	_, _, line, _ := runtime.Caller(1)
+	return line
+}
+
+func sourceLine(t *testing.T, entry map[string]interface{}) string {
+	t.Helper()
+	source, ok := entry["source"].(string)
+	if !ok {
+		t.Fatalf("expected 'source' field in log entry, got %v", entry["source"])
+	}
+	return strings.TrimSpace(source)
+}
+
+func TestHelper_SkipsMarkedFunction(t *testing.T) {
+	buf := setupTest(t)
+
+	line := callerLine() + 1
+	logThroughHelper("via helper")
+
+	want := fmt.Sprintf("source_test.go:%d", line)
+	if got := sourceLine(t, parseLogEntry(t, buf)); got != want {
+		t.Errorf("expected source %q, got %q", want, got)
+	}
+}
+
+func TestWithCallerSkip(t *testing.T) {
+	buf := setupTest(t)
+
+	line := callerLine() + 1
+	logThroughWrapper("via wrapper")
+
+	want := fmt.Sprintf("source_test.go:%d", line)
+	if got := sourceLine(t, parseLogEntry(t, buf)); got != want {
+		t.Errorf("expected source %q, got %q", want, got)
+	}
+}
+
+func TestWithCallerSkip_PreservedByWith(t *testing.T) {
+	buf := setupTest(t)
+
+	line := callerLine() + 3
+	func() {
+		WithCallerSkip(1).With("k", "v").Info("nested")
+	}()
+
+	want := fmt.Sprintf("source_test.go:%d", line)
+	if got := sourceLine(t, parseLogEntry(t, buf)); got != want {
+		t.Errorf("expected source %q, got %q", want, got)
+	}
+}
+
+func TestWithCallerSkip_Negative(t *testing.T) {
+	buf := setupTest(t)
+
+	for _, skip := range []int{-1, -2, -100} {
+		buf.Reset()
+		line := callerLine() + 1
+		WithCallerSkip(skip).Info("negative")
+		want := fmt.Sprintf("source_test.go:%d", line)
+		if got := sourceLine(t, parseLogEntry(t, buf)); got != want {
+			t.Errorf("WithCallerSkip(%d): expected source %q, got %q", skip, want, got)
+		}
+	}
+
+	// a negative skip undoes an earlier one
+	buf.Reset()
+	line := callerLine() + 1
+	logThroughUndoneSkip()
+	if got, want := sourceLine(t, parseLogEntry(t, buf)), fmt.Sprintf("source_test.go:%d", line); got != want {
+		t.Errorf("expected source %q, got %q", want, got)
+	}
+}
+
+// logThroughUndoneSkip skips two frames and undoes one, as logThroughWrapper.
+func logThroughUndoneSkip() {
+	WithCallerSkip(2).WithCallerSkip(-1).Info("undone")
+}
+
+func TestFilterFunctions_SourceIsCaller(t *testing.T) {
+	buf := setupTest(t)
+	AddFilter("db")
+
+	line := callerLine() + 1
+	DebugFilter("db", "package level filter")
+
+	want := fmt.Sprintf("source_test.go:%d", line)
+	if got := sourceLine(t, parseLogEntry(t, buf)); got != want {
+		t.Errorf("expected source %q, got %q", want, got)
+	}
+}
+
+func TestCallsiteCache_FormatSwitch(t *testing.T) {
+	buf := setupTest(t)
+
+	logAt := func() { Info("same callsite") }
+	for _, format := range []string{"short", "long", "func", "short"} {
+		SetSourceFormat(format)
+		buf.Reset()
+		logAt()
+		source := sourceLine(t, parseLogEntry(t, buf))
+		switch format {
+		case "short":
+			if !strings.HasPrefix(source, "source_test.go:") {
+				t.Errorf("expected short source after switching formats, got %q", source)
+			}
+		case "long":
+			if !strings.HasPrefix(source, "/") || !strings.Contains(source, "/source_test.go:") {
+				t.Errorf("expected long source after switching formats, got %q", source)
+			}
+		case "func":
+			if !strings.HasPrefix(source, "logsift.TestCallsiteCache_FormatSwitch.func1:") {
+				t.Errorf("expected func source after switching formats, got %q", source)
+			}
+		}
+	}
+}
+
+// uncachedSource is the source lookup without the callsite cache, kept as a
+// baseline for the benchmarks.
+func uncachedSource(format string) Source {
+	pc, file, line, ok := runtime.Caller(1)
+	if !ok {
+		return Source{File: "<???>", Line: 1}
+	}
+	function := ""
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		function = fn.Name()
+	}
+	if format == "short" {
+		file = file[strings.LastIndex(file, "/")+1:]
+	}
+	return Source{File: file, Line: line, Function: function, Package: funcPackage(function),
+		text: fmt.Sprintf(" %s:%d ", file, line)}
+}
+
+func BenchmarkSource_Uncached(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = uncachedSource("short")
+		}
+	})
+}
+
+// cachedSource resolves its caller through callerSite, 'frames' recursive
+// calls standing in for withSource, log and the logging method.
+func cachedSource(frames int) *callsite {
+	if frames == 0 {
+		return callerSite(0)
+	}
+	return cachedSource(frames - 1)
+}
+
+func BenchmarkSource_Cached(b *testing.B) {
+	o := &options{sourceFormat: "short"}
+	if cs := cachedSource(2); cs == nil || cs.source(o).File != "source_test.go" {
+		b.Fatalf("expected the benchmark as the source, got %+v", cs)
+	}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = cachedSource(2).source(o)
+		}
+	})
+}
+
+func BenchmarkInfo_Source(b *testing.B) {
+	SetOutput(io.Discard)
+	SetFormat("json")
+	SetLevel("info")
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			Info("benchmark")
+		}
+	})
+}
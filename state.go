@@ -0,0 +1,125 @@
+package logsift
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// State is the runtime configuration reported by Handler, durations and
+// sampling in the form of their Handler parameters.
+type State struct {
+	Level            string            `json:"level"`
+	Levels           string            `json:"levels"`
+	V                int               `json:"v"`
+	VModule          string            `json:"vmodule"`
+	Format           string            `json:"format"`
+	SourceFormat     string            `json:"sourceFormat"`
+	SourceStructured bool              `json:"sourceStructured"`
+	Sanitize         string            `json:"sanitize"`
+	Dedup            string            `json:"dedup"`
+	Filters          map[string]bool   `json:"filters"`
+	AllowEmptyFilter bool              `json:"allowEmptyFilter"`
+	FilterExpr       string            `json:"filterExpr"`
+	FilterField      string            `json:"filterField"`
+	FieldFilters     []FieldFilter     `json:"fieldFilters"`
+	FieldFilterTTL   string            `json:"fieldFilterTTL"`
+	Sampling         string            `json:"sampling"`
+	RateLimits       map[string]string `json:"rateLimits"`
+	RedactRules      []string          `json:"redactRules"`
+	Topics           []TopicInfo       `json:"topics"`
+	// recent changes, oldest first
+	Changes []ConfigChange `json:"changes"`
+}
+
+// GetState returns the current runtime configuration
+func GetState() State {
+	s := State{
+		Level:            GetLevel(),
+		Levels:           GetLevelDirectives(),
+		V:                GetVerbosity(),
+		VModule:          GetVModule(),
+		Format:           GetFormat(),
+		SourceFormat:     GetSourceFormat(),
+		SourceStructured: loadOptions().sourceStructured,
+		Sanitize:         GetSanitize(),
+		Dedup:            "off",
+		Filters:          GetFilters(),
+		AllowEmptyFilter: GetAllowEmptyFilter(),
+		FilterExpr:       GetFilterExpr(),
+		FilterField:      GetFilterField(),
+		FieldFilters:     GetFieldFilters(),
+		FieldFilterTTL:   GetFieldFilterTTL().String(),
+		Sampling:         "off",
+		RateLimits:       make(map[string]string),
+		RedactRules:      GetRedactionRules(),
+		Topics:           Topics(),
+		Changes:          RecentConfigChanges(),
+	}
+	if window := GetDedup(); window > 0 {
+		s.Dedup = window.String()
+	}
+	if first, thereafter, tick := GetSampling(); first > 0 || thereafter > 0 {
+		s.Sampling = fmt.Sprintf("%d:%d:%s", first, thereafter, tick)
+	}
+	for filter, limit := range GetFilterRateLimits() {
+		s.RateLimits[filter] = limit.String()
+	}
+	// empty lists rather than null for clients
+	if s.FieldFilters == nil {
+		s.FieldFilters = []FieldFilter{}
+	}
+	if s.RedactRules == nil {
+		s.RedactRules = []string{}
+	}
+	if s.Topics == nil {
+		s.Topics = []TopicInfo{}
+	}
+	if s.Changes == nil {
+		s.Changes = []ConfigChange{}
+	}
+	return s
+}
+
+// acceptsJSON reports whether the client asked for json
+func acceptsJSON(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, _ := mime.ParseMediaType(accept); mediaType == "application/json" {
+			return true
+		}
+	}
+	return false
+}
+
+// serveState writes the state as json
+func serveState(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(GetState()); err != nil {
+		Warn(err)
+	}
+}
+
+//go:embed ui/index.html
+var ui embed.FS
+
+// serveUI serves the admin page, which needs nothing but the Handler. The
+// page requests its siblings, so .../ui/ is redirected to .../ui relatively,
+// which holds behind a proxy or http.StripPrefix.
+func serveUI(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/") {
+		target := "../ui"
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		w.Header().Set("Location", target)
+		w.WriteHeader(http.StatusMovedPermanently)
+		return
+	}
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	http.ServeFileFS(w, r, ui, "ui/index.html")
+}
@@ -0,0 +1,172 @@
+package logsift
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetState(t *testing.T) {
+	setupTest(t)
+	SetLevel("warn")
+	SetDedup(30 * time.Second)
+	SetSampling(100, 10, time.Second)
+	SetFilterRateLimits(map[string]RateLimit{"db": {PerSecond: 50, Burst: 100}})
+	UpdateFilter(map[string]bool{"db": true, "cache": false})
+	SetAllowEmptyFilter(true)
+	AddFieldFilter("tenant", "acme", time.Minute)
+	RegisterFilter("state.test", "")
+
+	s := GetState()
+	if s.Level != "warning" || s.Format != "json" || s.SourceFormat != "short" {
+		t.Errorf("unexpected level, format or source format %q %q %q", s.Level, s.Format, s.SourceFormat)
+	}
+	if s.Dedup != "30s" || s.Sampling != "100:10:1s" || s.RateLimits["db"] != "50:100" {
+		t.Errorf("unexpected dedup, sampling or rate limits %q %q %v", s.Dedup, s.Sampling, s.RateLimits)
+	}
+	if !reflect.DeepEqual(s.Filters, map[string]bool{"db": true, "cache": false}) || !s.AllowEmptyFilter {
+		t.Errorf("unexpected filters %v, allowEmptyFilter %v", s.Filters, s.AllowEmptyFilter)
+	}
+	if len(s.FieldFilters) != 1 || s.FieldFilters[0].Key != "tenant" || s.FieldFilterTTL != "15m0s" {
+		t.Errorf("unexpected field filters %v, TTL %q", s.FieldFilters, s.FieldFilterTTL)
+	}
+	b, _ := json.Marshal(s)
+	if !strings.Contains(string(b), `"fieldFilters":[{"key":"tenant","value":"acme","expires":`) {
+		t.Errorf("unexpected json %s", b)
+	}
+	found := false
+	for _, topic := range s.Topics {
+		found = found || topic.Name == "state.test"
+	}
+	if !found {
+		t.Error("expected the registered topic")
+	}
+
+	// the filters reported are a copy
+	s.Filters["auth"] = true
+	if GetFilters()["auth"] {
+		t.Error("expected GetState to copy the filters")
+	}
+}
+
+func TestFilterSnapshot(t *testing.T) {
+	for name, f := range map[string]Filter{
+		"concurrent": NewConcurrentMapFilter(true),
+		"unsafe":     NewUnsafeMapFilter(true),
+		"atomic":     NewAtomicFilter(true),
+	} {
+		f.SetMap(map[string]bool{"db": true, "cache": false})
+		filters, allowEmpty := f.(filterSnapshot).snapshot()
+		if !reflect.DeepEqual(filters, map[string]bool{"db": true, "cache": false}) || !allowEmpty {
+			t.Errorf("%s: got %v, %v", name, filters, allowEmpty)
+		}
+	}
+}
+
+func TestRecentConfigChanges(t *testing.T) {
+	setupTest(t)
+	before := len(RecentConfigChanges())
+	Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/log?level=info&format=text", nil))
+	changes := RecentConfigChanges()
+	if len(changes) != min(before+2, maxConfigChanges) {
+		t.Fatalf("expected 2 more changes, got %v", changes)
+	}
+	last := changes[len(changes)-2:]
+	if last[0].Setting != "level" || last[0].Value != "info" || last[1].Setting != "format" || last[1].Time.IsZero() {
+		t.Errorf("unexpected changes %v", last)
+	}
+
+	for range maxConfigChanges + 5 {
+		recordConfigChange("level", "debug")
+	}
+	if got := len(RecentConfigChanges()); got != maxConfigChanges {
+		t.Errorf("expected %d changes kept, got %d", maxConfigChanges, got)
+	}
+}
+
+func TestHandler_State(t *testing.T) {
+	setupTest(t)
+	handler := Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/log/state", nil))
+	var s State
+	if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil || s.Level != "debug" {
+		t.Errorf("expected the state, got %v %s", err, rec.Body)
+	}
+
+	// changes return the state to clients accepting json
+	req := httptest.NewRequest("GET", "/log/?level=warn", nil)
+	req.Header.Set("Accept", "text/html, application/json;q=0.9")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil || s.Level != "warning" {
+		t.Errorf("expected the changed state, got %v %s", err, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected json, got %q", ct)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/log/?level=info", nil))
+	if rec.Body.Len() != 0 {
+		t.Errorf("expected no body for other clients, got %s", rec.Body)
+	}
+}
+
+func TestHandler_UI(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/log/ui", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("expected the page, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if csp := rec.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "default-src 'self'") {
+		t.Errorf("expected a content security policy, got %q", csp)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "<title>logsift</title>") {
+		t.Error("expected the admin page")
+	}
+	for _, external := range []string{`src="http`, `href="http`, "@import", "//cdn"} {
+		if strings.Contains(body, external) {
+			t.Errorf("expected no external assets, found %q", external)
+		}
+	}
+}
+
+func TestHandler_UITrailingSlash(t *testing.T) {
+	setupTest(t)
+	mux := http.NewServeMux()
+	mux.Handle("/admin/", http.StripPrefix("/admin", Handler()))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// the page's relative requests must reach the Handler, not the page
+	resp, err := http.Get(srv.URL + "/admin/ui/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/admin/ui" {
+		t.Errorf("expected a redirect to /admin/ui, got %d %s", resp.StatusCode, resp.Request.URL.Path)
+	}
+	set, err := resp.Request.URL.Parse("./?level=warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", set.String(), nil)
+	req.Header.Set("Accept", "application/json")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var s State
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil || s.Level != "warning" {
+		t.Errorf("expected the page's change to apply, got %v %+v", err, s)
+	}
+}
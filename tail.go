@@ -0,0 +1,334 @@
+package logsift
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	TailSubscribersGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "service_log_tail_subscribers",
+		Help: "number of live tail subscribers",
+	})
+	TailCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "service_log_tail_counter",
+		Help: "count of log entries sent to and dropped by live tail subscribers",
+	}, []string{"event"})
+)
+
+const (
+	// DefaultTailBuffer is the number of entries buffered per tail subscriber,
+	// entries are dropped when it is full
+	DefaultTailBuffer = 256
+	// MaxTailSubscribers bounds the live tails
+	MaxTailSubscribers = 64
+)
+
+// ErrTooManyTails is returned by Tail when MaxTailSubscribers are subscribed.
+var ErrTooManyTails = errors.New("too many live tail subscribers")
+
+// tailKeepalive is how often an idle tail stream sends a comment
+var tailKeepalive = 15 * time.Second
+
+// TailFilter selects the entries streamed to a live tail. Entries are
+// streamed whatever the level, filters, sampling and rate limits of the main
+// output, after redaction.
+type TailFilter struct {
+	// most verbose level streamed
+	Level logrus.Level
+	// topic globs such as "db.*", a filtered entry is streamed if one of its
+	// topics matches. Unfiltered entries are not streamed if Topics is set.
+	Topics []string
+	// fields an entry must have, values compared as text before redaction
+	Fields map[string]string
+	// filter expression, see SetFilterExpr
+	Expr string
+}
+
+type tailSubscriber struct {
+	level   logrus.Level
+	topics  []string
+	fields  map[string]string
+	expr    *filterExpr
+	entries chan []byte
+	// entries dropped since the subscriber last read
+	dropped atomic.Uint64
+}
+
+// tailSet is the subscribers with the union of the entries they stream, so
+// logging calls no subscriber wants are told apart before they are formatted
+type tailSet struct {
+	subs []*tailSubscriber
+	// most verbose level of the subscribers
+	level logrus.Level
+	// topic globs of the subscribers, unless one streams every entry
+	topics    []string
+	allTopics bool
+}
+
+func newTailSet(subs []*tailSubscriber) *tailSet {
+	set := &tailSet{subs: subs}
+	for _, sub := range subs {
+		set.level = max(set.level, sub.level)
+		if len(sub.topics) == 0 {
+			set.allTopics = true
+		}
+		set.topics = append(set.topics, sub.topics...)
+	}
+	return set
+}
+
+var (
+	tailMu sync.Mutex
+	// tails holds the subscribers, replaced on change so entries are
+	// published without locking
+	tails atomic.Pointer[tailSet]
+	// tailFormatter formats streamed entries, independently of the sinks
+	tailFormatter = &logrus.JSONFormatter{}
+)
+
+// tailWants reports whether a subscriber may stream an entry at 'level' with
+// 'filters', its fields left to publishTail
+func tailWants(level logrus.Level, filters []string) bool {
+	set := tails.Load()
+	if set == nil || len(set.subs) == 0 || level > set.level {
+		return false
+	}
+	return set.allTopics || matchTopics(set.topics, filters)
+}
+
+// Tail subscribes to the entries matching f as json lines. Up to 'buffer'
+// entries are buffered, DefaultTailBuffer if buffer <= 0, and entries are
+// dropped rather than block logging when the buffer is full. cancel
+// unsubscribes, the channel is left open as entries may still be in flight.
+func Tail(f TailFilter, buffer int) (entries <-chan []byte, cancel func(), err error) {
+	sub, err := newTailSubscriber(f, buffer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := subscribeTail(sub); err != nil {
+		return nil, nil, err
+	}
+	var once sync.Once
+	return sub.entries, func() { once.Do(func() { unsubscribeTail(sub) }) }, nil
+}
+
+func newTailSubscriber(f TailFilter, buffer int) (*tailSubscriber, error) {
+	if buffer <= 0 {
+		buffer = DefaultTailBuffer
+	}
+	for _, topic := range f.Topics {
+		if _, err := path.Match(topic, ""); err != nil {
+			return nil, fmt.Errorf("invalid topic %q: %w", topic, err)
+		}
+	}
+	sub := &tailSubscriber{level: f.Level, topics: f.Topics, fields: f.Fields, entries: make(chan []byte, buffer)}
+	if f.Expr != "" {
+		var err error
+		if sub.expr, err = compileFilterExpr(f.Expr); err != nil {
+			return nil, err
+		}
+	}
+	return sub, nil
+}
+
+func subscribeTail(sub *tailSubscriber) error {
+	tailMu.Lock()
+	defer tailMu.Unlock()
+	var subs []*tailSubscriber
+	if old := tails.Load(); old != nil {
+		subs = old.subs
+	}
+	if len(subs) >= MaxTailSubscribers {
+		return ErrTooManyTails
+	}
+	tails.Store(newTailSet(append(subs[:len(subs):len(subs)], sub)))
+	TailSubscribersGauge.Inc()
+	return nil
+}
+
+func unsubscribeTail(sub *tailSubscriber) {
+	tailMu.Lock()
+	defer tailMu.Unlock()
+	old := tails.Load().subs
+	subs := make([]*tailSubscriber, 0, len(old))
+	for _, s := range old {
+		if s != sub {
+			subs = append(subs, s)
+		}
+	}
+	tails.Store(newTailSet(subs))
+	TailSubscribersGauge.Dec()
+	// publishers may still hold the old list, closing the channel is left to
+	// the garbage collector
+}
+
+// publishTail sends an entry with 'filters' to the subscribers it matches,
+// redacting and formatting it once the first one does. entry is not
+// modified.
+func publishTail(entry *logrus.Entry, level logrus.Level, filters []string, msg string) {
+	set := tails.Load()
+	if set == nil {
+		return
+	}
+	var line []byte
+	for _, sub := range set.subs {
+		if !sub.matches(level, filters, entry.Data) {
+			continue
+		}
+		if line == nil {
+			if line = formatTail(entry, level, filters, msg); line == nil {
+				return
+			}
+		}
+		select {
+		case sub.entries <- line:
+			TailCounter.WithLabelValues("sent").Inc()
+		default:
+			sub.dropped.Add(1)
+			TailCounter.WithLabelValues("dropped").Inc()
+		}
+	}
+}
+
+// formatTail formats a redacted copy of entry as a json line, nil on error.
+// The line carries the topics in the "filter" field read by the logsift
+// command, whatever SetFilterField is set to.
+func formatTail(entry *logrus.Entry, level logrus.Level, filters []string, msg string) []byte {
+	e := entry.Dup()
+	e.Level, e.Message = level, msg
+	if len(filters) > 0 {
+		e.Data["filter"] = strings.Join(filters, ",")
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	redactionHook{}.Fire(e)
+	b, err := tailFormatter.Format(e)
+	if err != nil {
+		return nil
+	}
+	return bytes.TrimSuffix(b, []byte("\n"))
+}
+
+func (sub *tailSubscriber) matches(level logrus.Level, topics []string, fields logrus.Fields) bool {
+	if level > sub.level {
+		return false
+	}
+	if len(sub.topics) > 0 && !matchTopics(sub.topics, topics) {
+		return false
+	}
+	for key, value := range sub.fields {
+		v, ok := fields[key]
+		if !ok || exprString(v) != value {
+			return false
+		}
+	}
+	return sub.expr == nil || sub.expr.matches(level, topics, fields)
+}
+
+func matchTopics(globs, topics []string) bool {
+	for _, topic := range topics {
+		for _, glob := range globs {
+			if ok, _ := path.Match(glob, topic); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseTailFilter reads a TailFilter from ?level&topic&field&expr, topic
+// holding comma-separated globs and field repeated as key=value
+func parseTailFilter(r *http.Request) (TailFilter, error) {
+	f := TailFilter{Level: logrus.TraceLevel}
+	if v := r.FormValue("level"); v != "" {
+		level, err := logrus.ParseLevel(v)
+		if err != nil {
+			return f, err
+		}
+		f.Level = level
+	}
+	if v := r.FormValue("topic"); v != "" {
+		f.Topics = strings.Split(v, ",")
+	}
+	for _, field := range r.Form["field"] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || key == "" {
+			return f, fmt.Errorf("invalid field %q, expected key=value", field)
+		}
+		if f.Fields == nil {
+			f.Fields = make(map[string]string)
+		}
+		f.Fields[key] = value
+	}
+	f.Expr = r.FormValue("expr")
+	return f, nil
+}
+
+// serveTail streams the entries matching the request's filter as server-sent
+// events, a "dropped" event reports entries lost when the client fell behind
+func serveTail(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	f, err := parseTailFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sub, err := newTailSubscriber(f, DefaultTailBuffer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := subscribeTail(sub); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer unsubscribeTail(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(tailKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case line := <-sub.entries:
+			if n := sub.dropped.Swap(0); n > 0 {
+				fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", n)
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", line); err != nil {
+				return
+			}
+			// send what is buffered in one flush
+			for n := len(sub.entries); n > 0; n-- {
+				fmt.Fprintf(w, "data: %s\n\n", <-sub.entries)
+			}
+		}
+		flusher.Flush()
+	}
+}
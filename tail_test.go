@@ -0,0 +1,275 @@
+package logsift
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+)
+
+// received drains the entries buffered in a tail
+func received(t *testing.T, entries <-chan []byte) []map[string]interface{} {
+	t.Helper()
+	var res []map[string]interface{}
+	for {
+		select {
+		case line := <-entries:
+			var entry map[string]interface{}
+			if err := json.Unmarshal(line, &entry); err != nil {
+				t.Fatalf("invalid entry %s: %v", line, err)
+			}
+			res = append(res, entry)
+		default:
+			return res
+		}
+	}
+}
+
+// tailing reports whether there are live tail subscribers
+func tailing() bool {
+	set := tails.Load()
+	return set != nil && len(set.subs) > 0
+}
+
+func TestTail(t *testing.T) {
+	buf := setupTest(t)
+	SetLevel("info")
+
+	entries, cancel, err := Tail(TailFilter{Level: logrus.DebugLevel, Topics: []string{"db*"}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	DebugFilter("db", "query")           // streamed, not logged
+	InfoFilterf("db.pool", "open %d", 3) // streamed, not logged
+	Debug("unfiltered")                  // not streamed, not logged
+	DebugFilter("auth", "token")         // not streamed
+	With("password", "hunter2").DebugFilter("db", "login")
+
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing logged, got %s", buf)
+	}
+	got := received(t, entries)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 entries, got %v", got)
+	}
+	if got[0]["msg"] != "query" || got[0]["level"] != "debug" || got[0]["filter"] != "db" {
+		t.Errorf("unexpected entry %v", got[0])
+	}
+	if src, _ := got[0]["source"].(string); !strings.Contains(src, "tail_test.go:") {
+		t.Errorf("expected the source, got %v", got[0]["source"])
+	}
+	if got[1]["msg"] != "open 3" || got[1]["filter"] != "db.pool" {
+		t.Errorf("unexpected entry %v", got[1])
+	}
+	if got[2]["password"] != Redacted {
+		t.Errorf("expected the password to be redacted, got %v", got[2])
+	}
+
+	// entries that are logged are streamed too
+	AddFilter("db")
+	InfoFilter("db", "logged")
+	if got := received(t, entries); len(got) != 1 || got[0]["msg"] != "logged" || buf.Len() == 0 {
+		t.Errorf("expected the logged entry to be streamed, got %v", got)
+	}
+
+	cancel()
+	DebugFilter("db", "after cancel")
+	if got := received(t, entries); len(got) != 0 {
+		t.Errorf("expected nothing after cancel, got %v", got)
+	}
+	if tailing() {
+		t.Error("expected no subscribers")
+	}
+}
+
+func TestTail_Filter(t *testing.T) {
+	setupTest(t)
+	entries, cancel, err := Tail(TailFilter{
+		Level:  logrus.TraceLevel,
+		Fields: map[string]string{"tenant": "acme"},
+		Expr:   "duration_ms > 100",
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	WithFields(Fields{"tenant": "acme", "duration_ms": 120}).Info("slow")
+	WithFields(Fields{"tenant": "acme", "duration_ms": 20}).Info("fast")
+	WithFields(Fields{"tenant": "other", "duration_ms": 120}).Info("other")
+	if got := received(t, entries); len(got) != 1 || got[0]["msg"] != "slow" {
+		t.Errorf("expected only the slow acme entry, got %v", got)
+	}
+
+	for _, f := range []TailFilter{{Topics: []string{"[db"}}, {Expr: "level >"}} {
+		if _, _, err := Tail(f, 0); err == nil {
+			t.Errorf("Tail(%+v) succeeded, want an error", f)
+		}
+	}
+}
+
+func TestTailWants(t *testing.T) {
+	setupTest(t)
+	_, cancelDB, _ := Tail(TailFilter{Level: logrus.DebugLevel, Topics: []string{"db.*"}}, 1)
+	_, cancelErrors, _ := Tail(TailFilter{Level: logrus.ErrorLevel, Topics: []string{"auth"}}, 1)
+	if !tailWants(logrus.DebugLevel, []string{"db.pool"}) || !tailWants(logrus.ErrorLevel, []string{"auth"}) {
+		t.Error("expected entries a subscriber streams to be wanted")
+	}
+	if tailWants(logrus.TraceLevel, []string{"db.pool"}) || tailWants(logrus.DebugLevel, nil) || tailWants(logrus.InfoLevel, []string{"cache"}) {
+		t.Error("expected entries no subscriber streams not to be wanted")
+	}
+
+	// a subscriber without topics streams unfiltered entries
+	cancelErrors()
+	cancelDB()
+	_, cancelAll, _ := Tail(TailFilter{Level: logrus.WarnLevel}, 1)
+	if !tailWants(logrus.WarnLevel, nil) || tailWants(logrus.InfoLevel, nil) {
+		t.Error("expected the union to follow the subscribers")
+	}
+	cancelAll()
+	if tailWants(logrus.ErrorLevel, nil) {
+		t.Error("expected nothing wanted without subscribers")
+	}
+}
+
+func TestTail_Drops(t *testing.T) {
+	setupTest(t)
+	subscribers := testutil.ToFloat64(TailSubscribersGauge)
+	dropped := testutil.ToFloat64(TailCounter.WithLabelValues("dropped"))
+
+	entries, cancel, err := Tail(TailFilter{Level: logrus.InfoLevel}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(TailSubscribersGauge) - subscribers; got != 1 {
+		t.Errorf("expected 1 more subscriber, got %v", got)
+	}
+	for range 5 {
+		Info("burst")
+	}
+	if got := received(t, entries); len(got) != 2 {
+		t.Errorf("expected 2 buffered entries, got %d", len(got))
+	}
+	if got := testutil.ToFloat64(TailCounter.WithLabelValues("dropped")) - dropped; got != 3 {
+		t.Errorf("expected 3 dropped entries, got %v", got)
+	}
+	cancel()
+	cancel()
+	if got := testutil.ToFloat64(TailSubscribersGauge) - subscribers; got != 0 {
+		t.Errorf("expected the subscriber to be removed once, got %v", got)
+	}
+}
+
+func TestTail_Max(t *testing.T) {
+	setupTest(t)
+	var cancels []func()
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+	for range MaxTailSubscribers {
+		_, cancel, err := Tail(TailFilter{}, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cancels = append(cancels, cancel)
+	}
+	if _, _, err := Tail(TailFilter{}, 1); err != ErrTooManyTails {
+		t.Errorf("expected ErrTooManyTails, got %v", err)
+	}
+}
+
+func TestTail_Handler(t *testing.T) {
+	setupTest(t)
+	SetLevel("warn")
+	mux := http.NewServeMux()
+	mux.Handle("/log/", Handler())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/log/tail?level=loud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid level, got %d", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/log/tail?level=debug&topic=db&field=tenant=acme", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected an event stream, got %q", ct)
+	}
+	for !tailing() {
+		time.Sleep(time.Millisecond)
+	}
+
+	With("tenant", "other").DebugFilter("db", "skipped")
+	With("tenant", "acme").DebugFilter("db", "streamed")
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			if !strings.Contains(data, `"msg":"streamed"`) {
+				t.Errorf("unexpected entry %s", data)
+			}
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	for deadline := time.Now().Add(time.Second); tailing() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if tailing() {
+		t.Error("expected the subscriber to be removed when the client leaves")
+	}
+}
+
+// BenchmarkDebug_SuppressedWhileTailing covers a call that is neither logged
+// nor streamed while a subscriber streams other entries
+func BenchmarkDebug_SuppressedWhileTailing(b *testing.B) {
+	SetOutput(io.Discard)
+	SetLevel("info")
+	UpdateFilter(make(map[string]bool))
+	for name, f := range map[string]TailFilter{
+		"level":  {Level: logrus.ErrorLevel},
+		"topics": {Level: logrus.TraceLevel, Topics: []string{"auth"}},
+	} {
+		b.Run(name, func(b *testing.B) {
+			_, cancel, err := Tail(f, 1)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer cancel()
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					Debug("benchmark")
+					DebugFilter("db", "benchmark")
+				}
+			})
+		})
+	}
+}
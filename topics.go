@@ -0,0 +1,230 @@
+package logsift
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// MaxTopics bounds the registry, topics seen after it is full are not
+	// recorded
+	MaxTopics = 1000
+	// maxTopicSources is the number of sample source locations kept per topic
+	maxTopicSources = 5
+	// topicStripes is the number of counters per topic, so goroutines logging
+	// the same topic mostly count on different cache lines
+	topicStripes = 8
+	// topicClockTick is the resolution of the first and last seen times
+	topicClockTick = time.Second
+)
+
+// TopicInfo describes a filter topic, registered via RegisterFilter or seen
+// in a filtered logging call.
+type TopicInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Registered  bool   `json:"registered"`
+	// whether the default logger's filters allow the topic
+	Enabled bool `json:"enabled"`
+	// first and last logging call, to topicClockTick
+	FirstSeen time.Time `json:"firstSeen,omitzero"`
+	LastSeen  time.Time `json:"lastSeen,omitzero"`
+	// entries logged
+	Hits uint64 `json:"hits"`
+	// entries not logged because of the level, filters, sampling or rate limits
+	Suppressed uint64 `json:"suppressed"`
+	// sample call sites as "import/path/file.go:line"
+	Sources []string `json:"sources,omitempty"`
+}
+
+type topicStats struct {
+	firstSeen atomic.Int64
+	lastSeen  atomic.Int64
+	_         [48]byte
+	counts    [topicStripes]topicCounts
+
+	mu          sync.Mutex
+	description string
+	registered  bool
+	sources     []string
+	sourcesFull atomic.Bool
+}
+
+// topicCounts is a stripe of a topic's counts, padded to a cache line
+type topicCounts struct {
+	hits       atomic.Uint64
+	suppressed atomic.Uint64
+	_          [48]byte
+}
+
+var (
+	topicMu sync.Mutex
+	// topicRegistry holds the topics by name, replaced when a topic is added
+	// so filtered calls look topics up without locking
+	topicRegistry atomic.Pointer[map[string]*topicStats]
+	// topicStripe picks the stripe a call counts on
+	topicStripe = func() uint32 { return rand.Uint32() % topicStripes }
+
+	// topicClock is the time in unix nanoseconds to topicClockTick, read
+	// instead of time.Now on every filtered call
+	topicClock     atomic.Int64
+	topicClockOnce sync.Once
+)
+
+// startTopicClock starts the clock of the first and last seen times, once a
+// topic is recorded
+func startTopicClock() {
+	topicClockOnce.Do(func() {
+		topicClock.Store(time.Now().UnixNano())
+		go func() {
+			for now := range time.Tick(topicClockTick) {
+				topicClock.Store(now.UnixNano())
+			}
+		}()
+	})
+}
+
+func lookupTopic(name string) *topicStats {
+	if topics := topicRegistry.Load(); topics != nil {
+		if t, ok := (*topics)[name]; ok {
+			return t
+		}
+		// the registry only grows, once full a miss needs no lock
+		if len(*topics) >= MaxTopics {
+			return nil
+		}
+	}
+	topicMu.Lock()
+	defer topicMu.Unlock()
+	var old map[string]*topicStats
+	if topics := topicRegistry.Load(); topics != nil {
+		old = *topics
+	}
+	if t, ok := old[name]; ok {
+		return t
+	}
+	if len(old) >= MaxTopics {
+		return nil
+	}
+	topics := make(map[string]*topicStats, len(old)+1)
+	maps.Copy(topics, old)
+	t := &topicStats{}
+	topics[name] = t
+	topicRegistry.Store(&topics)
+	startTopicClock()
+	return t
+}
+
+// RegisterFilter records a filter topic with a description, so it is listed
+// before it is first logged.
+func RegisterFilter(name, description string) {
+	t := lookupTopic(name)
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.description, t.registered = description, true
+}
+
+// noteTopics counts a filtered logging call, 'skip' being the logger's. It
+// writes to memory shared by the goroutines logging a topic only when the
+// clock advanced, counting on one of the topic's stripes.
+func noteTopics(filters []string, logged bool, skip int) {
+	if len(filters) == 0 {
+		return
+	}
+	for _, name := range filters {
+		t := lookupTopic(name)
+		if t == nil {
+			continue
+		}
+		now := topicClock.Load()
+		if t.firstSeen.Load() == 0 {
+			t.firstSeen.CompareAndSwap(0, now)
+		}
+		if now > t.lastSeen.Load() {
+			t.lastSeen.Store(now)
+		}
+		c := &t.counts[topicStripe()]
+		var n uint64
+		if logged {
+			n = c.hits.Add(1)
+		} else {
+			n = c.suppressed.Add(1)
+		}
+		// look up the caller on the 1st, 2nd, 4th, 8th... call of each
+		// kind on a stripe, so new call sites are found at a logarithmic
+		// cost
+		if n&(n-1) == 0 && !t.sourcesFull.Load() {
+			// skip runtime.Callers, callerSite, noteTopics, log and the
+			// logging method
+			if cs := callerSite(skip); cs != nil {
+				t.addSource(fmt.Sprintf("%s/%s:%d", cs.pkg, cs.short, cs.line))
+			}
+		}
+	}
+}
+
+func (t *topicStats) addSource(source string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.sources {
+		if s == source {
+			return
+		}
+	}
+	t.sources = append(t.sources, source)
+	t.sourcesFull.Store(len(t.sources) >= maxTopicSources)
+}
+
+// Topics returns the registered and seen filter topics sorted by name
+func Topics() []TopicInfo {
+	topics := topicRegistry.Load()
+	if topics == nil {
+		return nil
+	}
+	infos := make([]TopicInfo, 0, len(*topics))
+	for name, t := range *topics {
+		info := TopicInfo{
+			Name:    name,
+			Enabled: defaultLogger.FiltersAllow(name),
+		}
+		for i := range t.counts {
+			info.Hits += t.counts[i].hits.Load()
+			info.Suppressed += t.counts[i].suppressed.Load()
+		}
+		if ns := t.firstSeen.Load(); ns != 0 {
+			info.FirstSeen = time.Unix(0, ns)
+			info.LastSeen = time.Unix(0, t.lastSeen.Load())
+		}
+		t.mu.Lock()
+		info.Description, info.Registered = t.description, t.registered
+		info.Sources = append([]string(nil), t.sources...)
+		t.mu.Unlock()
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// serveTopics lists the filter topics as json
+func serveTopics(w http.ResponseWriter, _ *http.Request) {
+	infos := Topics()
+	if infos == nil {
+		infos = []TopicInfo{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(infos); err != nil {
+		Warn(err)
+	}
+}
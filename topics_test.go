@@ -0,0 +1,188 @@
+package logsift
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func topicInfo(t *testing.T, name string) TopicInfo {
+	t.Helper()
+	for _, info := range Topics() {
+		if info.Name == name {
+			return info
+		}
+	}
+	t.Fatalf("expected topic %q in %v", name, Topics())
+	return TopicInfo{}
+}
+
+// oneStripe counts topics on a single stripe, so the calls a source is looked
+// up on do not depend on the stripes picked
+func oneStripe(t *testing.T) {
+	stripe := topicStripe
+	topicStripe = func() uint32 { return 0 }
+	t.Cleanup(func() { topicStripe = stripe })
+}
+
+func TestTopics_Seen(t *testing.T) {
+	setupTest(t)
+	oneStripe(t)
+	AddFilter("topics.seen")
+
+	_, _, line, _ := runtime.Caller(0)
+	for i := 0; i < 3; i++ {
+		DebugFilter("topics.seen", "logged")
+	}
+	DebugFilters([]string{"topics.seen", "topics.other"}, "logged twice")
+	RemoveFilter("topics.seen")
+	InfoFilterf("topics.seen", "suppressed %d", 1)
+
+	info := topicInfo(t, "topics.seen")
+	if info.Hits != 4 || info.Suppressed != 1 || info.Enabled {
+		t.Errorf("unexpected counts %+v", info)
+	}
+	if info.FirstSeen.IsZero() || info.LastSeen.Before(info.FirstSeen) {
+		t.Errorf("unexpected first and last seen %+v", info)
+	}
+	want := []string{
+		fmt.Sprintf("github.com/jenish-rudani/logsift/topics_test.go:%d", line+2),
+		fmt.Sprintf("github.com/jenish-rudani/logsift/topics_test.go:%d", line+4),
+		fmt.Sprintf("github.com/jenish-rudani/logsift/topics_test.go:%d", line+6),
+	}
+	if fmt.Sprint(info.Sources) != fmt.Sprint(want) {
+		t.Errorf("expected sources %v, got %v", want, info.Sources)
+	}
+	if other := topicInfo(t, "topics.other"); other.Hits != 1 {
+		t.Errorf("expected a hit for every filter of the call, got %+v", other)
+	}
+}
+
+func TestTopics_Concurrent(t *testing.T) {
+	setupTest(t)
+	SetOutput(io.Discard)
+	AddFilter("topics.concurrent")
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			for range 100 {
+				DebugFilter("topics.concurrent", "logged")
+				DebugFilter("topics.concurrent.off", "suppressed")
+			}
+		})
+	}
+	wg.Wait()
+	if info := topicInfo(t, "topics.concurrent"); info.Hits != 800 {
+		t.Errorf("expected the hits of all stripes, got %+v", info)
+	}
+	if info := topicInfo(t, "topics.concurrent.off"); info.Suppressed != 800 || info.LastSeen.IsZero() {
+		t.Errorf("expected the suppressed entries of all stripes, got %+v", info)
+	}
+}
+
+func TestTopics_Registered(t *testing.T) {
+	setupTest(t)
+	RegisterFilter("topics.registered", "cache lookups")
+	info := topicInfo(t, "topics.registered")
+	if !info.Registered || info.Description != "cache lookups" || !info.FirstSeen.IsZero() || info.Hits != 0 {
+		t.Errorf("unexpected registered topic %+v", info)
+	}
+
+	SetLevel("info")
+	DebugFilter("topics.registered", "below level")
+	if info := topicInfo(t, "topics.registered"); info.Suppressed != 1 || !info.Registered {
+		t.Errorf("expected suppressed entry counted, got %+v", info)
+	}
+}
+
+func TestTopics_Handler(t *testing.T) {
+	setupTest(t)
+	RegisterFilter("topics.handler", "listed")
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/log/topics", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected json, got %q", ct)
+	}
+	var infos []TopicInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &infos); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, info := range infos {
+		found = found || (info.Name == "topics.handler" && info.Description == "listed")
+	}
+	if !found {
+		t.Errorf("expected registered topic in %s", w.Body.String())
+	}
+
+	// other paths still change the configuration
+	Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/log/?level=warn", nil))
+	if GetLevel() != "warning" {
+		t.Errorf("expected level warning, got %q", GetLevel())
+	}
+}
+
+// BenchmarkDebugFilter_Suppressed covers the topic bookkeeping of a filtered
+// call that is not logged, shared by every goroutine logging the topic
+func BenchmarkDebugFilter_Suppressed(b *testing.B) {
+	SetOutput(io.Discard)
+	SetLevel("debug")
+	UpdateFilter(make(map[string]bool))
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			DebugFilter("db", "benchmark")
+		}
+	})
+}
+
+// fillTopics fills the registry up to MaxTopics for the test
+func fillTopics(tb testing.TB) {
+	saved := topicRegistry.Load()
+	tb.Cleanup(func() { topicRegistry.Store(saved) })
+	for i := 0; lookupTopic(fmt.Sprintf("topics.fill.%d", i)) != nil; i++ {
+	}
+}
+
+func TestTopics_Full(t *testing.T) {
+	setupTest(t)
+	lookupTopic("topics.full")
+	fillTopics(t)
+
+	// a miss on a full registry must not wait for topicMu
+	topicMu.Lock()
+	defer topicMu.Unlock()
+	done := make(chan *topicStats)
+	go func() { done <- lookupTopic("topics.over") }()
+	select {
+	case ts := <-done:
+		if ts != nil {
+			t.Error("expected no topic once the registry is full")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected lookup on a full registry not to lock")
+	}
+	if lookupTopic("topics.full") == nil {
+		t.Error("expected known topic to be found")
+	}
+}
+
+// BenchmarkDebugFilter_Full covers filtered calls on topics the full registry
+// does not record
+func BenchmarkDebugFilter_Full(b *testing.B) {
+	SetOutput(io.Discard)
+	SetLevel("debug")
+	UpdateFilter(make(map[string]bool))
+	fillTopics(b)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			DebugFilter("topics.over", "benchmark")
+		}
+	})
+}
@@ -0,0 +1,203 @@
+package logsift
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Verbose logs at info level if its verbosity is enabled, see V. The zero
+// value logs nothing.
+type Verbose struct {
+	l *logger
+}
+
+// V returns a Verbose that logs if 'level' is at most the verbosity set by
+// SetVerbosity or a vmodule pattern matching the caller's file. Guard
+// expensive arguments with Enabled:
+//
+//	if v := logsift.V(3); v.Enabled() {
+//		v.Info(expensive())
+//	}
+func V(level int) Verbose {
+	return defaultLogger.verbose(level)
+}
+
+func (l *logger) V(level int) Verbose {
+	return l.verbose(level)
+}
+
+// verbose is called by V, the caller of V is two frames up
+func (l *logger) verbose(level int) Verbose {
+	o := loadOptions()
+	if level <= o.verbosity {
+		return Verbose{l}
+	}
+	if o.vmodule == nil {
+		return Verbose{}
+	}
+	var pc [1]uintptr
+	// skip runtime.Callers, verbose and V
+	if runtime.Callers(3+l.skip, pc[:]) == 0 {
+		return Verbose{}
+	}
+	if level <= o.vmodule.siteVerbosity(lookupCallsite(pc[0]), o.verbosity) {
+		return Verbose{l}
+	}
+	return Verbose{}
+}
+
+// Enabled reports whether v logs
+func (v Verbose) Enabled() bool {
+	return v.l != nil
+}
+
+func (v Verbose) Info(args ...interface{}) {
+	if v.l != nil {
+		v.l.log(logrus.InfoLevel, nil, args...)
+	}
+}
+
+func (v Verbose) Infoln(args ...interface{}) {
+	if v.l != nil {
+		v.l.logln(logrus.InfoLevel, nil, args...)
+	}
+}
+
+func (v Verbose) Infof(format string, args ...interface{}) {
+	if v.l != nil {
+		v.l.logf(logrus.InfoLevel, nil, format, args...)
+	}
+}
+
+// InfoFilter logs only if v is enabled and 'filter' is allowed
+func (v Verbose) InfoFilter(filter string, args ...interface{}) {
+	if v.l != nil {
+		v.l.log(logrus.InfoLevel, []string{filter}, args...)
+	}
+}
+
+func (v Verbose) InfoFilterf(filter string, format string, args ...interface{}) {
+	if v.l != nil {
+		v.l.logf(logrus.InfoLevel, []string{filter}, format, args...)
+	}
+}
+
+// SetVerbosity sets the level up to which V logs, the -v of klog
+func SetVerbosity(level int) {
+	updateOptions(func(o *options) {
+		o.verbosity = level
+	})
+}
+
+func GetVerbosity() int {
+	return loadOptions().verbosity
+}
+
+// vmodule overrides the verbosity by source file, parsed from a string such
+// as "server=2,db/*=4". A pattern is a filepath.Match glob on the file's path
+// without ".go", cut to as many trailing elements as the pattern has. The
+// first matching pattern wins.
+type vmodule struct {
+	text     string
+	gen      uint64
+	patterns []vmodulePattern
+}
+
+type vmodulePattern struct {
+	pattern string
+	// number of slashes in pattern
+	depth int
+	level int
+}
+
+// vmoduleGen numbers vmodule specs, so callsites can tell a cached decision
+// is stale
+var vmoduleGen atomic.Uint64
+
+func parseVModule(text string) (*vmodule, error) {
+	m := &vmodule{text: text, gen: vmoduleGen.Add(1)}
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		pattern, value, ok := strings.Cut(part, "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid vmodule %q, expected pattern=N", part)
+		}
+		level, err := strconv.Atoi(value)
+		if err != nil || level < 0 || level >= matchedVerbosity {
+			return nil, fmt.Errorf("invalid vmodule %q, expected pattern=N", part)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid vmodule %q: %w", part, err)
+		}
+		pattern = strings.TrimSuffix(pattern, ".go")
+		m.patterns = append(m.patterns, vmodulePattern{pattern: pattern, depth: strings.Count(pattern, "/"), level: level})
+	}
+	return m, nil
+}
+
+func (p vmodulePattern) matches(file string) bool {
+	file = strings.TrimSuffix(file, ".go")
+	start := len(file)
+	for i := 0; i <= p.depth && start > 0; i++ {
+		start = strings.LastIndex(file[:start], "/")
+	}
+	ok, _ := filepath.Match(p.pattern, file[start+1:])
+	return ok
+}
+
+// matchedVerbosity marks a vmodule match, kept in the callsite as
+// gen<<32 | matchedVerbosity | level
+const matchedVerbosity = 1 << 31
+
+// siteVerbosity returns the verbosity at cs, 'verbosity' being the global one
+func (m *vmodule) siteVerbosity(cs *callsite, verbosity int) int {
+	c := cs.vCache.Load()
+	if c>>32 != m.gen {
+		c = m.gen << 32
+		for _, p := range m.patterns {
+			if p.matches(cs.file) {
+				c |= matchedVerbosity | uint64(p.level)
+				break
+			}
+		}
+		cs.vCache.Store(c)
+	}
+	if c&matchedVerbosity != 0 {
+		return int(c & (matchedVerbosity - 1))
+	}
+	return verbosity
+}
+
+// SetVModule sets the verbosity by source file with patterns such as
+// "server=2,db/*=4", the -vmodule of klog. The decision is cached per call
+// site. An empty string removes the patterns.
+func SetVModule(spec string) error {
+	var m *vmodule
+	if spec != "" {
+		var err error
+		if m, err = parseVModule(spec); err != nil {
+			return err
+		}
+	}
+	updateOptions(func(o *options) {
+		o.vmodule = m
+	})
+	return nil
+}
+
+// GetVModule returns the vmodule patterns, empty if none
+func GetVModule() string {
+	if m := loadOptions().vmodule; m != nil {
+		return m.text
+	}
+	return ""
+}
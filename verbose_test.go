@@ -0,0 +1,140 @@
+package logsift
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestV_Verbosity(t *testing.T) {
+	buf := setupTest(t)
+	SetVerbosity(2)
+
+	V(3).Info("too verbose")
+	if buf.Len() != 0 {
+		t.Fatalf("expected V(3) to be disabled, got %s", buf.String())
+	}
+	if V(3).Enabled() || !V(2).Enabled() {
+		t.Error("expected V(2) enabled and V(3) disabled")
+	}
+
+	_, _, line, _ := runtime.Caller(0)
+	V(2).Infof("verbose %d", 2)
+	entry := parseLogEntry(t, buf)
+	if entry["msg"] != "verbose 2" || entry["level"] != "info" {
+		t.Errorf("unexpected entry %v", entry)
+	}
+	if want := fmt.Sprintf(" verbose_test.go:%d ", line+1); entry["source"] != want {
+		t.Errorf("expected source %q, got %v", want, entry["source"])
+	}
+}
+
+func TestV_LevelFiltersAndFields(t *testing.T) {
+	buf := setupTest(t)
+	SetVerbosity(1)
+
+	With("request_id", "abc").(ExtendedLogger).V(1).Info("with fields")
+	if entry := parseLogEntry(t, buf); entry["request_id"] != "abc" {
+		t.Errorf("expected field on entry, got %v", entry)
+	}
+
+	buf.Reset()
+	V(1).InfoFilter("db", "filtered")
+	SetLevel("warn")
+	V(0).Info("below level")
+	if buf.Len() != 0 {
+		t.Errorf("expected level and filters to apply, got %s", buf.String())
+	}
+}
+
+func TestV_VModule(t *testing.T) {
+	buf := setupTest(t)
+	_, file, _, _ := runtime.Caller(0)
+	dir := filepath.Base(filepath.Dir(file))
+	tests := []struct {
+		vmodule string
+		want    bool
+	}{
+		{"verbose_test=3", true},
+		{"verbose_test.go=3", true},
+		{"verbose_*=4", true},
+		{dir + "/verbose_test=3", true},
+		{"*/" + dir + "/verbose_test=3", true},
+		{"other/verbose_test=3", false},
+		{"verbose_test=2", false},
+		{"server=5", false},
+		{"verbose_test=1,verbose_*=5", false},
+	}
+	for _, tt := range tests {
+		if err := SetVModule(tt.vmodule); err != nil {
+			t.Fatal(err)
+		}
+		buf.Reset()
+		// same call site for every spec, the cached decision must follow
+		V(3).Info("vmodule")
+		if got := buf.Len() > 0; got != tt.want {
+			t.Errorf("%s: expected logged %v, got %v", tt.vmodule, tt.want, got)
+		}
+	}
+	for _, spec := range []string{"server", "server=x", "server=-1", "[=2"} {
+		if err := SetVModule(spec); err == nil {
+			t.Errorf("%s: expected error", spec)
+		}
+	}
+}
+
+func TestV_Handler(t *testing.T) {
+	setupTest(t)
+	req := httptest.NewRequest("GET", "/log?v=3&vmodule=server=5,db/*=4", nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if GetVerbosity() != 3 || GetVModule() != "server=5,db/*=4" {
+		t.Fatalf("unexpected verbosity %d and vmodule %q", GetVerbosity(), GetVModule())
+	}
+
+	req = httptest.NewRequest("GET", "/log?v=-1", nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if GetVerbosity() != 3 {
+		t.Errorf("expected invalid verbosity to be rejected, got %d", GetVerbosity())
+	}
+
+	req = httptest.NewRequest("GET", "/log?vmodule=none", nil)
+	Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if got := GetVModule(); got != "" {
+		t.Errorf("expected vmodule removed, got %q", got)
+	}
+}
+
+func TestV_Flags(t *testing.T) {
+	setupTest(t)
+	t.Setenv("APP_LOG_V", "2")
+	t.Setenv("APP_LOG_VMODULE", "db=4")
+	if err := ConfigureFromEnv("APP_"); err != nil {
+		t.Fatal(err)
+	}
+	if GetVerbosity() != 2 || !strings.Contains(GetVModule(), "db=4") {
+		t.Errorf("unexpected verbosity %d and vmodule %q", GetVerbosity(), GetVModule())
+	}
+}
+
+func BenchmarkV(b *testing.B) {
+	for _, bm := range []struct{ name, vmodule string }{
+		{"Disabled", ""},
+		{"DisabledVModule", "server=5"},
+	} {
+		if err := SetVModule(bm.vmodule); err != nil {
+			b.Fatal(err)
+		}
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if V(3).Enabled() {
+					b.Fatal("expected V(3) disabled")
+				}
+			}
+		})
+	}
+	SetVModule("")
+}